@@ -1,4 +1,5 @@
 import { QueryClient, type QueryFunction } from "@tanstack/react-query";
+import { authToken } from "@/lib/utils";
 
 async function throwIfResNotOk(res: Response) {
   if (!res.ok) {
@@ -17,6 +18,7 @@ export async function getRequest(
   let errorMsg = `${method} ${url} failed after ${retries} attempts`;
 
   for (let attempt = 0; attempt < retries; attempt++) {
+    const token = await authToken();
     // Exponential backoff timeout (2s → 4s → 8s)
     const timeout = Math.min(baseTimeout * 2 ** attempt, maxTimeout);
     // Setup abort controller for timeout
@@ -27,7 +29,7 @@ export async function getRequest(
       const res = await fetch(url, {
         method,
         headers: {
-          "Onlyquant-Token": localStorage.getItem("oqAuthToken") || "",
+          "Onlyquant-Token": token,
         },
         credentials: "include",
         signal: controller.signal,
@@ -63,6 +65,7 @@ export async function postRequest(
   let errorMsg = `${method} ${url} failed after ${retries} attempts`;
 
   for (let attempt = 0; attempt < retries; attempt++) {
+    const token = await authToken();
     // Exponential backoff timeout (2s → 4s → 8s)
     const timeout = Math.min(baseTimeout * 2 ** attempt, maxTimeout);
     // Setup abort controller for timeout
@@ -74,7 +77,7 @@ export async function postRequest(
         method,
         headers: {
           "Content-Type": "application/json",
-          "Onlyquant-Token": localStorage.getItem("oqAuthToken") || "",
+          "Onlyquant-Token": token,
         },
         body: JSON.stringify(data),
         credentials: "include",
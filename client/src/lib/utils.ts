@@ -2,7 +2,6 @@ import { UserLangEnum, type UserLang } from "@/lib/model";
 import { invoke } from "@tauri-apps/api/core";
 import { clsx, type ClassValue } from "clsx";
 import { twMerge } from "tailwind-merge";
-import { v4 as uuidv4 } from "uuid";
 
 export const ZERO_UUID = "00000000-0000-0000-0000-000000000000";
 
@@ -66,57 +65,65 @@ export async function checkAuth(): Promise<void> {
 
   // Check if we need to authenticate
   if (!localStorage.getItem("oqAuthToken")) {
-    startOidcAuthentication();
+    await startOidcAuthentication();
     return;
   }
 }
 
-const startOidcAuthentication = () => {
-  const state = uuidv4();
-  sessionStorage.setItem("oidc_state", state);
-  const redirectUri = encodeURIComponent(
-    window.location.origin + "/oidc/callback",
-  );
+const oidcRedirectUri = () => window.location.origin + "/oidc/callback";
 
-  const clientId =
-    "Tp6WnNpVj9Sa8gdPZt8bVGq~yjKnjUZkG8J5IJ~aoIj5-Azn~pXUXq5fPXP-8BLQqOVnxq8P";
-  const authUrl = `https://auth.onlyquant.top/api/oidc/authorization?client_id=${clientId}&redirect_uri=${redirectUri}&response_type=code&scope=openid%20profile%20email&state=${state}`;
-  window.location.href = authUrl;
-};
+interface Tokens {
+  token: string;
+  expiresAt: number;
+  refreshToken: string;
+  deviceId: string;
+}
 
-const handleOidcCallback = async () => {
-  const urlParams = new URLSearchParams(window.location.search);
-  const code = urlParams.get("code");
-  const state = urlParams.get("state");
+const storeTokens = (tokens: Tokens) => {
+  localStorage.setItem("oqAuthToken", tokens.token);
+  localStorage.setItem("oqTokenExpiresAt", String(tokens.expiresAt));
+  localStorage.setItem("oqRefreshToken", tokens.refreshToken);
+  localStorage.setItem("oqDeviceId", tokens.deviceId);
+};
 
-  // Verify state parameter
-  const savedState = sessionStorage.getItem("oidc_state");
+const clearTokens = () => {
+  localStorage.removeItem("oqAuthToken");
+  localStorage.removeItem("oqTokenExpiresAt");
+  localStorage.removeItem("oqRefreshToken");
+};
 
-  if (!savedState || savedState !== state) {
-    throw new Error(
-      `Invalid state parameter - saved: ${savedState}, received: ${state}`,
-    );
+// the server starts the login, keeping its state to check the callback
+const startOidcAuthentication = async () => {
+  const response = await fetch(
+    `/api/auth?Action=Login&redirect_uri=${encodeURIComponent(oidcRedirectUri())}`,
+  );
+  const data = await response.json();
+  if (!response.ok || data.code !== 200) {
+    throw new Error(`Failed to start login: ${data.message}`);
   }
+  window.location.href = data.message.authorizationUrl;
+};
 
-  // Exchange code for token
-  const redirectUri = encodeURIComponent(
-    window.location.origin + "/oidc/callback",
-  );
+const handleOidcCallback = async () => {
+  const urlParams = new URLSearchParams(window.location.search);
+  const code = urlParams.get("code") || "";
+  const state = urlParams.get("state") || "";
+
+  // Exchange code for tokens, the server checks the state
   try {
     const response = await fetch(
-      `/api/auth?Action=Auth&code=${code}&redirect_uri=${redirectUri}`,
+      `/api/auth?Action=Auth&code=${encodeURIComponent(code)}&state=${encodeURIComponent(state)}`,
+      {
+        headers: { "Only-Device-Id": localStorage.getItem("oqDeviceId") || "" },
+      },
     );
-    if (!response.ok) {
-      throw new Error("Failed to authenticate");
-    }
     const data = await response.json();
-    if (data.message.token) {
-      localStorage.setItem("oqAuthToken", data.message.token);
-      // Remove state after successful authentication
-      sessionStorage.removeItem("oidc_state");
-      // Clear the code from URL
-      window.history.replaceState({}, document.title, window.location.origin);
+    if (!response.ok || data.code !== 200) {
+      throw new Error(`Failed to authenticate: ${data.message}`);
     }
+    storeTokens(data.message);
+    // Clear the code from URL
+    window.history.replaceState({}, document.title, window.location.origin);
   } catch (err) {
     throw new Error(
       err instanceof Error ? err.message : "Authentication failed",
@@ -124,6 +131,56 @@ const handleOidcCallback = async () => {
   }
 };
 
+let renewing: Promise<string> | null = null;
+
+// renewTokens replaces the stored tokens by the ones Action replies, or signs
+// in again when the server refuses them.
+const renewTokens = async (
+  action: string,
+  init: RequestInit,
+): Promise<string> => {
+  const response = await fetch(`/api/auth?Action=${action}`, {
+    method: "POST",
+    ...init,
+  });
+  const data = await response.json().catch(() => ({}));
+  if (!response.ok || data.code !== 200) {
+    // the refresh token is used up, expired or revoked
+    clearTokens();
+    await startOidcAuthentication();
+    throw new Error("Session expired");
+  }
+  storeTokens(data.message);
+  return data.message.token;
+};
+
+// authToken returns the access token to send in Onlyquant-Token, refreshed
+// shortly before it expires. A token stored before tokens expired is
+// exchanged for expiring ones first.
+export async function authToken(): Promise<string> {
+  const token = localStorage.getItem("oqAuthToken") || "";
+  const expiresAt = Number(localStorage.getItem("oqTokenExpiresAt") || 0);
+  if (!token || (expiresAt && Date.now() < expiresAt - 60_000)) {
+    return token;
+  }
+  if (!renewing) {
+    const renewal = expiresAt
+      ? renewTokens("Refresh", {
+          headers: { "Content-Type": "application/json" },
+          body: JSON.stringify({
+            refreshToken: localStorage.getItem("oqRefreshToken") || "",
+          }),
+        })
+      : renewTokens("ExchangeLegacyToken", {
+          headers: { "Onlyquant-Token": token },
+        });
+    renewing = renewal.finally(() => {
+      renewing = null;
+    });
+  }
+  return renewing;
+}
+
 export function dateString(
   date: number | Date | string | null | undefined,
   sep: string = "/",
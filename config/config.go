@@ -14,8 +14,11 @@ func Init() {
 	if err := LoadCfg(); err != nil {
 		panic(err)
 	}
-	if service.Key() == "" {
-		panic("DASHBOARD_ENCRYPT_KEY is not set")
+	if _, err := service.Keys(); err != nil {
+		panic(err)
+	}
+	if service.TokenSecret() == "" {
+		panic("DASHBOARD_TOKEN_SECRET is not set")
 	}
 
 	// logger
@@ -16,7 +16,8 @@ import (
 )
 
 var (
-	db *gorm.DB
+	db  *gorm.DB
+	dsn string
 
 	loggerConfig = logger.Config{
 		LogLevel:                  logger.Info,
@@ -31,13 +32,14 @@ var (
 
 func InitDB() {
 	passwd := os.Getenv("POSTGRES_PASSWORD")
-	db = openDB(
+	dsn = fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=%s",
 		viper.GetString("db.host"),
-		viper.GetString("db.port"),
 		viper.GetString("db.username"),
 		passwd,
 		viper.GetString("db.name"),
-	)
+		viper.GetString("db.port"),
+		time.Local)
+	db = openDB(dsn, viper.GetString("db.name"))
 
 	if gin.Mode() == gin.DebugMode {
 		loggerConfig.ParameterizedQueries = false
@@ -49,14 +51,13 @@ func ContextDB(ctx context.Context) *gorm.DB {
 	return db.Session(&gorm.Session{Logger: gormLogger})
 }
 
-func openDB(host, port, username, password, name string) *gorm.DB {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=%s",
-		host,
-		username,
-		password,
-		name,
-		port,
-		time.Local)
+// DSN returns the connection string of the database, for connections that
+// can not go through the pool such as LISTEN.
+func DSN() string {
+	return dsn
+}
+
+func openDB(dsn, name string) *gorm.DB {
 	log.Info(log.WorkerCtx, "db connection uses timezone "+time.Local.String())
 
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
@@ -81,3 +82,8 @@ func openDB(host, port, username, password, name string) *gorm.DB {
 
 	return db
 }
+
+// UseDB replaces the database, for tests that run against another one.
+func UseDB(d *gorm.DB) {
+	db = d
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"slices"
+	"time"
+
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ListAccessTokens lists the personal access tokens of the user.
+func (base Base) ListAccessTokens(c *gin.Context, req *ListAccessTokensRequest) *ListAccessTokensResponse {
+	tokens, err := model.ListAccessTokens(config.ContextDB(c), middleware.GetUserId(c))
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	return &ListAccessTokensResponse{Tokens: tokens}
+}
+
+type ListAccessTokensRequest struct {
+}
+
+type ListAccessTokensResponse struct {
+	Tokens []model.AccessToken `json:"tokens"`
+}
+
+// CreateAccessToken mints a personal access token limited to Scopes, see
+// middleware.Scopes. It never expires when ExpiresAt is unset. The token is
+// only returned here.
+func (base Base) CreateAccessToken(c *gin.Context, req *CreateAccessTokenRequest) *CreateAccessTokenResponse {
+	scopes := middleware.Scopes()
+	for _, scope := range req.Scopes {
+		if !slices.Contains(scopes, scope) {
+			handler.Errorf(c, "unknown scope %s", scope)
+			return nil
+		}
+	}
+	token := &model.AccessToken{
+		CreatorId: middleware.GetUserId(c),
+		Name:      req.Name,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+	}
+	if req.ExpiresAt != 0 {
+		expiresAt := time.UnixMilli(req.ExpiresAt)
+		if !expiresAt.After(time.Now()) {
+			handler.Errorf(c, "expiresAt is in the past")
+			return nil
+		}
+		token.ExpiresAt = model.NewNullTime(expiresAt)
+	}
+
+	plain, hash, err := service.NewPersonalToken()
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	token.Prefix = plain[:12]
+	token.TokenHash = hash
+	if err := token.Create(config.ContextDB(c)); err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	middleware.Audit(c, token.CreatorId, model.AuditCredentialAdded, model.AuditSuccess, "access token "+token.Prefix)
+	return &CreateAccessTokenResponse{AccessToken: *token, Token: plain}
+}
+
+type CreateAccessTokenRequest struct {
+	Name   string   `json:"name" binding:"required,max=255"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	// ExpiresAt is in milliseconds
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+type CreateAccessTokenResponse struct {
+	model.AccessToken
+	Token string `json:"token"`
+}
+
+// RevokeAccessToken deletes a personal access token of the user.
+func (base Base) RevokeAccessToken(c *gin.Context, req *RevokeAccessTokenRequest) *RevokeAccessTokenResponse {
+	revoked, err := model.DeleteAccessToken(config.ContextDB(c), middleware.GetUserId(c), req.Id)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if !revoked {
+		handler.Errorf(c, "access token not found")
+		return nil
+	}
+	middleware.Audit(c, middleware.GetUserId(c), model.AuditCredentialGone, model.AuditSuccess, "access token "+req.Id.String())
+	return &RevokeAccessTokenResponse{}
+}
+
+type RevokeAccessTokenRequest struct {
+	Id uuid.UUID `json:"id" binding:"required"`
+}
+
+type RevokeAccessTokenResponse struct {
+}
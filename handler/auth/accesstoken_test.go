@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessTokens(t *testing.T) {
+	g, _ := setupAuthTests(t, &model.AccessToken{})
+	access, _, err := service.IssueAccessToken(testTokenSecret, 7, "device-1", time.Minute)
+	require.NoError(t, err)
+
+	create := CreateAccessTokenRequest{Name: "backup", Scopes: []string{"todo:read", "entry:read"}}
+	t.Run("tokens are not created by GET", func(t *testing.T) {
+		code, _ := call(t, g, http.MethodGet, "CreateAccessToken&name=backup&scopes=todo:read", nil, "Onlyquant-Token", access)
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+	})
+
+	var created CreateAccessTokenResponse
+	t.Run("a token is created with its scopes", func(t *testing.T) {
+		code, message := call(t, g, http.MethodPost, "CreateAccessToken", create, "Onlyquant-Token", access)
+		require.Equal(t, http.StatusOK, code, string(message))
+		require.NoError(t, json.Unmarshal(message, &created))
+		assert.Equal(t, []string{"entry:read", "todo:read"}, []string(created.Scopes))
+		assert.NotEmpty(t, created.Token)
+	})
+
+	t.Run("a token can not manage tokens", func(t *testing.T) {
+		code, _ := call(t, g, http.MethodGet, "ListAccessTokens", nil, "Onlyquant-Token", created.Token)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("a revoked token is refused", func(t *testing.T) {
+		code, message := call(t, g, http.MethodPost, "RevokeAccessToken", RevokeAccessTokenRequest{Id: created.Id}, "Onlyquant-Token", access)
+		require.Equal(t, http.StatusOK, code, string(message))
+		code, _ = call(t, g, http.MethodGet, "ListAccessTokens", nil, "Onlyquant-Token", created.Token)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		code, message = call(t, g, http.MethodGet, "ListAccessTokens", nil, "Onlyquant-Token", access)
+		require.Equal(t, http.StatusOK, code, string(message))
+		assert.JSONEq(t, `{"tokens":[]}`, string(message))
+	})
+}
@@ -1,57 +1,173 @@
 package auth
 
 import (
-	"os"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
 
+	"github.com/EricWvi/dashboard/config"
 	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
 	"github.com/EricWvi/dashboard/service"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
 )
 
-func (base Base) Auth(c *gin.Context, req *AuthRequest) *AuthResponse {
-	// Get OIDC configuration
-	tokenEndpoint := viper.GetString("oidc.tokenEndpoint")
-	userinfoEndpoint := viper.GetString("oidc.userinfoEndpoint")
-	clientID := viper.GetString("oidc.clientId")
-	clientSecret := os.Getenv("DASHBOARD_CLIENT_SECRET")
+// loginTtl is how long the user has to complete a login at the identity provider
+const loginTtl = 10 * time.Minute
+
+// Login starts a login at the identity provider Provider of oidc.providers,
+// the default one when it is empty. The client sends the user to
+// AuthorizationURL and passes the code and state it gets back at RedirectURI
+// to the Auth Action.
+func (base Base) Login(c *gin.Context, req *LoginRequest) *LoginResponse {
+	return startLogin(c, req.Provider, req.RedirectURI, 0)
+}
+
+type LoginRequest struct {
+	Provider    string `form:"provider"`
+	RedirectURI string `form:"redirect_uri" binding:"required"`
+}
+
+type LoginResponse struct {
+	AuthorizationURL string `json:"authorizationUrl"`
+	State            string `json:"state"`
+}
+
+// startLogin starts a login at the provider name, linking its identity to
+// linkUserId unless it is 0.
+func startLogin(c *gin.Context, name, redirectURI string, linkUserId uint) *LoginResponse {
+	if uris := viper.GetStringSlice("oidc.redirectUris"); len(uris) > 0 && !slices.Contains(uris, redirectURI) {
+		handler.Errorf(c, "redirect_uri is not allowed")
+		return nil
+	}
+	if name == "" {
+		name = service.DefaultOIDCProvider()
+	}
+	provider, err := service.OIDC(name)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
 
-	if tokenEndpoint == "" || userinfoEndpoint == "" || clientID == "" || clientSecret == "" {
-		handler.Errorf(c, "OIDC is not properly configured")
+	state, err := service.RandomString(32)
+	if err != nil {
+		handler.Errorf(c, "failed to create state: %v", err)
+		return nil
+	}
+	nonce, err := service.RandomString(32)
+	if err != nil {
+		handler.Errorf(c, "failed to create nonce: %v", err)
+		return nil
+	}
+	login := &model.OIDCLogin{
+		State:        state,
+		Provider:     provider.Name,
+		LinkUserId:   linkUserId,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		RedirectURI:  redirectURI,
+	}
+	if err := model.CreateOIDCLogin(config.ContextDB(c), login, loginTtl); err != nil {
+		handler.Errorf(c, "%s", err.Error())
 		return nil
 	}
 
-	// Step 1: Exchange authorization code for access token
-	tokenResp, err := service.ExchangeCodeForToken(tokenEndpoint, req.Code, clientID, clientSecret, req.RedirectURI)
+	return &LoginResponse{
+		AuthorizationURL: provider.AuthCodeURL(login.RedirectURI, login.State, login.Nonce, login.CodeVerifier),
+		State:            state,
+	}
+}
+
+// Auth completes a login started by the Login or LinkIdentity Action and signs
+// the user in. Identities are matched by their subject at the provider, see
+// model.SignInIdentity. Signing in as a new user is refused with code 403
+// unless the registration policy lets them in, see model.SignInUser. A link is
+// only completed along with the access token of the user who started it, so
+// that nobody can complete a link started by someone else.
+func (base Base) Auth(c *gin.Context, req *AuthRequest) *AuthResponse {
+	// Step 1: Find the login the state was issued for
+	db := config.ContextDB(c)
+	login, err := model.TakeOIDCLogin(db, req.State)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if login == nil {
+		handler.Errorf(c, "login is unknown or expired")
+		return nil
+	}
+	if login.LinkUserId != 0 && middleware.GetUserId(c) != login.LinkUserId {
+		middleware.Audit(c, login.LinkUserId, model.AuditLogin, model.AuditFailure, "identity link completed by another session")
+		handler.ReplyData(c, http.StatusForbidden, "identity link was started by another user")
+		return nil
+	}
+	provider, err := service.OIDC(login.Provider)
 	if err != nil {
-		handler.Errorf(c, "failed to exchange code for token: %v", err)
+		handler.Errorf(c, "%s", err.Error())
 		return nil
 	}
 
-	// Step 2: Get user info using access token
-	userInfo, err := service.GetUserInfo(userinfoEndpoint, tokenResp.AccessToken)
+	// Step 2: Exchange authorization code for a verified identity
+	identity, err := provider.Exchange(c, req.Code, login.RedirectURI, login.Nonce, login.CodeVerifier)
 	if err != nil {
-		handler.Errorf(c, "failed to get user info: %v", err)
+		middleware.Audit(c, login.LinkUserId, model.AuditLogin, model.AuditFailure, provider.Name+": "+err.Error())
+		handler.Errorf(c, "failed to sign in: %v", err)
 		return nil
 	}
 
-	// Step 3: Encrypt email and return as token
-	encryptedToken, err := service.Encrypt(service.Key(), userInfo.Email)
+	// Step 3: Sign the user in, registering them as the policy allows
+	userId, created := login.LinkUserId, false
+	if userId != 0 {
+		err = model.LinkUserIdentity(db, userId, provider.Name, identity.Subject, identity.Email)
+	} else {
+		inviteHash := ""
+		if req.Invite != "" {
+			inviteHash = service.HashToken(req.Invite)
+		}
+		userId, created, err = model.SignInIdentity(db, provider.Name, identity.Subject, identity.Email, provider.LinkByEmail, inviteHash)
+	}
+	if err != nil {
+		middleware.Audit(c, login.LinkUserId, model.AuditLogin, model.AuditFailure, provider.Name+": "+err.Error())
+	}
+	if errors.Is(err, model.ErrNotAllowlisted) || errors.Is(err, model.ErrInviteRequired) ||
+		errors.Is(err, model.ErrInviteInvalid) || errors.Is(err, model.ErrIdentityNotLinked) ||
+		errors.Is(err, model.ErrIdentityLinked) {
+		handler.ReplyData(c, http.StatusForbidden, err.Error())
+		return nil
+	}
 	if err != nil {
-		handler.Errorf(c, "failed to encrypt token: %v", err)
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if created {
+		middleware.Audit(c, userId, model.AuditUserCreated, model.AuditSuccess, provider.Name)
+	}
+	if login.LinkUserId != 0 {
+		middleware.Audit(c, userId, model.AuditCredentialAdded, model.AuditSuccess, "identity "+provider.Name)
+	}
+	middleware.Audit(c, userId, model.AuditLogin, model.AuditSuccess, provider.Name)
+	tokens, err := issueTokens(c, userId)
+	if err != nil {
+		handler.Errorf(c, "failed to issue tokens: %v", err)
 		return nil
 	}
 
 	return &AuthResponse{
-		Token: encryptedToken,
+		Tokens: *tokens,
 	}
 }
 
 type AuthRequest struct {
-	Code        string `form:"code" binding:"required"`
-	RedirectURI string `form:"redirect_uri" binding:"required"`
+	Code  string `form:"code" binding:"required"`
+	State string `form:"state" binding:"required"`
+	// Invite is redeemed to register while registration.policy is invite
+	Invite string `form:"invite"`
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
+	Tokens
 }
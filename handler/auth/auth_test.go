@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/log"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const testTokenSecret = "test-token-secret"
+
+// setupAuthTests serves the auth Actions the way router.go does, against an
+// in-memory database holding the given tables.
+func setupAuthTests(t *testing.T, tables ...any) (*gin.Engine, *gorm.DB) {
+	log.InitLogger(slog.LevelWarn)
+	t.Setenv("DASHBOARD_TOKEN_SECRET", testTokenSecret)
+	viper.Set("route.back.base", "/api")
+	t.Cleanup(func() { viper.Set("route.back.base", nil) })
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	// every connection would get its own in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.AutoMigrate(append([]any{&model.AuditEvent{}}, tables...)...))
+	config.UseDB(db)
+	t.Cleanup(func() { config.UseDB(nil) })
+
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(middleware.BodyWriter())
+	g.Use(middleware.JWT())
+	back := g.Group("/api")
+	back.Use(middleware.Logging())
+	back.GET("/auth", DefaultHandler)
+	back.POST("/auth", DefaultHandler)
+	return g, db
+}
+
+// call sends Action to the auth route, with body as JSON when it is not nil,
+// and returns the reply.
+func call(t *testing.T, g *gin.Engine, method, action string, body any, header ...string) (int, json.RawMessage) {
+	var payload *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		payload = bytes.NewReader(data)
+	} else {
+		payload = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, "/api/auth?Action="+action, payload)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+
+	rsp := struct {
+		Code    int             `json:"code"`
+		Message json.RawMessage `json:"message"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp), w.Body.String())
+	return rsp.Code, rsp.Message
+}
+
+func TestRefresh(t *testing.T) {
+	g, db := setupAuthTests(t, &model.RefreshToken{})
+	refresh, hash, err := service.NewRefreshToken()
+	require.NoError(t, err)
+	_, err = model.CreateRefreshToken(db, 7, "device-1", uuid.Nil, hash, time.Hour)
+	require.NoError(t, err)
+
+	t.Run("refresh tokens are not accepted in urls", func(t *testing.T) {
+		code, _ := call(t, g, http.MethodGet, "Refresh&refreshToken="+refresh, nil)
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+	})
+
+	var tokens Tokens
+	t.Run("refresh rotates the token", func(t *testing.T) {
+		code, message := call(t, g, http.MethodPost, "Refresh", RefreshRequest{RefreshToken: refresh})
+		require.Equal(t, http.StatusOK, code, string(message))
+		require.NoError(t, json.Unmarshal(message, &tokens))
+		assert.NotEqual(t, refresh, tokens.RefreshToken)
+
+		claims, err := service.ParseAccessToken(testTokenSecret, tokens.Token)
+		require.NoError(t, err)
+		userId, err := claims.UserId()
+		require.NoError(t, err)
+		assert.Equal(t, uint(7), userId)
+		assert.Equal(t, "device-1", claims.DeviceId)
+	})
+
+	t.Run("a used refresh token revokes its family", func(t *testing.T) {
+		code, _ := call(t, g, http.MethodPost, "Refresh", RefreshRequest{RefreshToken: refresh})
+		assert.Equal(t, http.StatusUnauthorized, code)
+		code, _ = call(t, g, http.MethodPost, "Refresh", RefreshRequest{RefreshToken: tokens.RefreshToken})
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+}
+
+func TestRefreshBindsDevice(t *testing.T) {
+	g, db := setupAuthTests(t, &model.RefreshToken{})
+	refresh, hash, err := service.NewRefreshToken()
+	require.NoError(t, err)
+	// issued before tokens were bound to a device
+	_, err = model.CreateRefreshToken(db, 7, "", uuid.Nil, hash, time.Hour)
+	require.NoError(t, err)
+
+	code, message := call(t, g, http.MethodPost, "Refresh", RefreshRequest{RefreshToken: refresh}, "Only-Device-Id", "device-2")
+	require.Equal(t, http.StatusOK, code, string(message))
+	var tokens Tokens
+	require.NoError(t, json.Unmarshal(message, &tokens))
+	claims, err := service.ParseAccessToken(testTokenSecret, tokens.Token)
+	require.NoError(t, err)
+	assert.NotEmpty(t, claims.DeviceId)
+	// the header does not choose the device of an existing login
+	assert.NotEqual(t, "device-2", claims.DeviceId)
+	assert.Equal(t, claims.DeviceId, tokens.DeviceId)
+
+	revoked, err := model.RevokeDeviceRefreshTokens(db, 7, claims.DeviceId)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+}
+
+func TestLogout(t *testing.T) {
+	g, db := setupAuthTests(t, &model.RefreshToken{})
+	refresh, hash, err := service.NewRefreshToken()
+	require.NoError(t, err)
+	_, err = model.CreateRefreshToken(db, 7, "device-1", uuid.Nil, hash, time.Hour)
+	require.NoError(t, err)
+	access, _, err := service.IssueAccessToken(testTokenSecret, 7, "device-1", time.Minute)
+	require.NoError(t, err)
+
+	code, message := call(t, g, http.MethodPost, "Logout", LogoutRequest{RefreshToken: refresh}, "Onlyquant-Token", access)
+	require.Equal(t, http.StatusOK, code, string(message))
+	assert.JSONEq(t, `{"revoked":1}`, string(message))
+
+	code, _ = call(t, g, http.MethodPost, "Refresh", RefreshRequest{RefreshToken: refresh})
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAuthCompletesLinksOfTheirUser(t *testing.T) {
+	g, db := setupAuthTests(t, &model.OIDCLogin{})
+	link := func(t *testing.T, header ...string) int {
+		state, err := service.RandomString(32)
+		require.NoError(t, err)
+		require.NoError(t, model.CreateOIDCLogin(db, &model.OIDCLogin{State: state, Provider: "unconfigured",
+			LinkUserId: 7, RedirectURI: "https://dashboard.test/oidc/callback"}, time.Minute))
+		code, _ := call(t, g, http.MethodGet, "Auth&code=code&state="+state, nil, header...)
+		return code
+	}
+	token := func(t *testing.T, userId uint) string {
+		access, _, err := service.IssueAccessToken(testTokenSecret, userId, "device-1", time.Minute)
+		require.NoError(t, err)
+		return access
+	}
+
+	t.Run("a link is refused without the token of its user", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, link(t))
+		assert.Equal(t, http.StatusForbidden, link(t, "Onlyquant-Token", token(t, 8)))
+		assert.Equal(t, http.StatusForbidden, link(t, "Onlyquant-Token", "not-a-token"))
+	})
+
+	t.Run("a link goes on with the token of its user", func(t *testing.T) {
+		// and fails further on, at the unconfigured provider
+		assert.Equal(t, http.StatusBadRequest, link(t, "Onlyquant-Token", token(t, 7)))
+	})
+}
@@ -1,12 +1,36 @@
 package auth
 
 import (
+	"net/http"
+
 	"github.com/EricWvi/dashboard/handler"
 	"github.com/gin-gonic/gin"
 )
 
 type Base struct{}
 
+// postActions are sent by POST with a JSON body. Their requests do not bind
+// from a query, and Refresh and Logout carry refresh tokens, which must not
+// end up in URLs and the logs of proxies.
+var postActions = map[string]bool{
+	"Refresh":                   true,
+	"Logout":                    true,
+	"LinkIdentity":              true,
+	"UnlinkIdentity":            true,
+	"CreateAccessToken":         true,
+	"RevokeAccessToken":         true,
+	"CreateInvite":              true,
+	"RevokeInvite":              true,
+	"FinishPasskeyRegistration": true,
+	"FinishPasskeyLogin":        true,
+	"RemovePasskey":             true,
+	"CreateEventTicket":         true,
+}
+
 func DefaultHandler(c *gin.Context) {
+	if action := c.GetString("Action"); postActions[action] && c.Request.Method != http.MethodPost {
+		handler.ReplyError(c, http.StatusMethodNotAllowed, action+" must be sent by POST")
+		return
+	}
 	handler.Dispatch(c, Base{})
 }
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/gin-gonic/gin"
+)
+
+// ExchangeLegacyToken signs in the device sending a legacy token, an
+// encrypted email that never expires, so that it can move to expiring tokens
+// without going through the login again. See auth.acceptLegacyTokens.
+func (base Base) ExchangeLegacyToken(c *gin.Context, req *ExchangeLegacyTokenRequest) *ExchangeLegacyTokenResponse {
+	if !middleware.UsesLegacyToken(c) {
+		handler.Errorf(c, "request is not authenticated by a legacy token")
+		return nil
+	}
+	tokens, err := issueTokens(c, middleware.GetUserId(c))
+	if err != nil {
+		handler.Errorf(c, "failed to issue tokens: %v", err)
+		return nil
+	}
+	middleware.Audit(c, middleware.GetUserId(c), model.AuditLogin, model.AuditSuccess, "legacy token")
+	return &ExchangeLegacyTokenResponse{
+		Tokens: *tokens,
+	}
+}
+
+type ExchangeLegacyTokenRequest struct {
+}
+
+type ExchangeLegacyTokenResponse struct {
+	Tokens
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+)
+
+// ListProviders lists the identity providers users sign in with.
+func (base Base) ListProviders(c *gin.Context, req *ListProvidersRequest) *ListProvidersResponse {
+	configs, err := service.OIDCProviderConfigs()
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	providers := make([]Provider, 0, len(configs))
+	for name, config := range configs {
+		displayName := config.DisplayName
+		if displayName == "" {
+			displayName = name
+		}
+		providers = append(providers, Provider{Name: name, DisplayName: displayName})
+	}
+	slices.SortFunc(providers, func(a, b Provider) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return &ListProvidersResponse{Providers: providers, Default: service.DefaultOIDCProvider()}
+}
+
+type ListProvidersRequest struct {
+}
+
+type Provider struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type ListProvidersResponse struct {
+	Providers []Provider `json:"providers"`
+	Default   string     `json:"default"`
+}
+
+// LinkIdentity starts a login at Provider linking the identity the user signs
+// in with to their account, completed by the Auth Action like Login.
+func (base Base) LinkIdentity(c *gin.Context, req *LinkIdentityRequest) *LinkIdentityResponse {
+	resp := startLogin(c, req.Provider, req.RedirectURI, middleware.GetUserId(c))
+	if resp == nil {
+		return nil
+	}
+	return &LinkIdentityResponse{LoginResponse: *resp}
+}
+
+type LinkIdentityRequest struct {
+	Provider    string `json:"provider" binding:"required"`
+	RedirectURI string `json:"redirectUri" binding:"required"`
+}
+
+type LinkIdentityResponse struct {
+	LoginResponse
+}
+
+// ListIdentities lists the identities linked to the user.
+func (base Base) ListIdentities(c *gin.Context, req *ListIdentitiesRequest) *ListIdentitiesResponse {
+	identities, err := model.ListUserIdentities(config.ContextDB(c), middleware.GetUserId(c))
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	return &ListIdentitiesResponse{Identities: identities}
+}
+
+type ListIdentitiesRequest struct {
+}
+
+type ListIdentitiesResponse struct {
+	Identities []model.UserIdentity `json:"identities"`
+}
+
+// UnlinkIdentity removes an identity of the user. The last way to sign in, an
+// identity when there is no passkey, is kept.
+func (base Base) UnlinkIdentity(c *gin.Context, req *UnlinkIdentityRequest) *UnlinkIdentityResponse {
+	db := config.ContextDB(c)
+	userId := middleware.GetUserId(c)
+	identities, err := model.ListUserIdentities(db, userId)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if len(identities) == 1 {
+		passkeys, err := model.ListPasskeys(db, userId)
+		if err != nil {
+			handler.Errorf(c, "%s", err.Error())
+			return nil
+		}
+		if len(passkeys) == 0 {
+			handler.Errorf(c, "can not unlink the last way to sign in")
+			return nil
+		}
+	}
+	unlinked, err := model.UnlinkUserIdentity(db, userId, req.Provider, req.Subject)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if !unlinked {
+		handler.Errorf(c, "identity not found")
+		return nil
+	}
+	middleware.Audit(c, userId, model.AuditCredentialGone, model.AuditSuccess, "identity "+req.Provider)
+	return &UnlinkIdentityResponse{}
+}
+
+type UnlinkIdentityRequest struct {
+	Provider string `json:"provider" binding:"required"`
+	Subject  string `json:"subject" binding:"required"`
+}
+
+type UnlinkIdentityResponse struct {
+}
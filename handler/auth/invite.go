@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// requireAdmin replies code 403 unless the user is an administrator, see
+// registration.admins.
+func requireAdmin(c *gin.Context) bool {
+	admin, err := model.IsAdmin(config.ContextDB(c), middleware.GetUserId(c))
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return false
+	}
+	if !admin {
+		handler.ReplyData(c, http.StatusForbidden, model.ErrInviteForbidden.Error())
+		return false
+	}
+	return true
+}
+
+// CreateInvite creates a single use invite code, redeemed by the Auth Action
+// of someone registering. It never expires when ExpiresAt is unset. The code
+// is only returned here.
+func (base Base) CreateInvite(c *gin.Context, req *CreateInviteRequest) *CreateInviteResponse {
+	if !requireAdmin(c) {
+		return nil
+	}
+	invite := &model.Invite{CreatorId: middleware.GetUserId(c)}
+	if req.ExpiresAt != 0 {
+		expiresAt := time.UnixMilli(req.ExpiresAt)
+		if !expiresAt.After(time.Now()) {
+			handler.Errorf(c, "expiresAt is in the past")
+			return nil
+		}
+		invite.ExpiresAt = model.NewNullTime(expiresAt)
+	}
+
+	code, err := service.RandomString(16)
+	if err != nil {
+		handler.Errorf(c, "failed to create invite code: %v", err)
+		return nil
+	}
+	invite.Prefix = code[:6]
+	invite.CodeHash = service.HashToken(code)
+	if err := invite.Create(config.ContextDB(c)); err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	return &CreateInviteResponse{Invite: *invite, Code: code}
+}
+
+type CreateInviteRequest struct {
+	// ExpiresAt is in milliseconds
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+type CreateInviteResponse struct {
+	model.Invite
+	Code string `json:"code"`
+}
+
+// ListInvites lists the invites created by the administrator.
+func (base Base) ListInvites(c *gin.Context, req *ListInvitesRequest) *ListInvitesResponse {
+	if !requireAdmin(c) {
+		return nil
+	}
+	invites, err := model.ListInvites(config.ContextDB(c), middleware.GetUserId(c))
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	return &ListInvitesResponse{Invites: invites}
+}
+
+type ListInvitesRequest struct {
+}
+
+type ListInvitesResponse struct {
+	Invites []model.Invite `json:"invites"`
+}
+
+// RevokeInvite deletes an invite that was not used yet.
+func (base Base) RevokeInvite(c *gin.Context, req *RevokeInviteRequest) *RevokeInviteResponse {
+	if !requireAdmin(c) {
+		return nil
+	}
+	revoked, err := model.DeleteInvite(config.ContextDB(c), middleware.GetUserId(c), req.Id)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if !revoked {
+		handler.Errorf(c, "invite not found or already used")
+		return nil
+	}
+	return &RevokeInviteResponse{}
+}
+
+type RevokeInviteRequest struct {
+	Id uuid.UUID `json:"id" binding:"required"`
+}
+
+type RevokeInviteResponse struct {
+}
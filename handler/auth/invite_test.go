@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvites(t *testing.T) {
+	g, db := setupAuthTests(t, &model.User{}, &model.Invite{})
+	model.SetRegistrationPolicy(model.RegistrationPolicy{Mode: model.RegistrationInvite, Admins: []string{"root@example.com"}})
+	t.Cleanup(func() { model.SetRegistrationPolicy(model.RegistrationPolicy{Mode: model.RegistrationOpen}) })
+	admin := &model.User{Email: "root@example.com"}
+	require.NoError(t, db.Create(admin).Error)
+	access, _, err := service.IssueAccessToken(testTokenSecret, admin.ID, "device-1", time.Minute)
+	require.NoError(t, err)
+
+	var invite CreateInviteResponse
+	code, message := call(t, g, http.MethodPost, "CreateInvite", CreateInviteRequest{}, "Onlyquant-Token", access)
+	require.Equal(t, http.StatusOK, code, string(message))
+	require.NoError(t, json.Unmarshal(message, &invite))
+
+	code, _ = call(t, g, http.MethodGet, "RevokeInvite&id="+invite.Id.String(), nil, "Onlyquant-Token", access)
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	code, message = call(t, g, http.MethodPost, "RevokeInvite", RevokeInviteRequest{Id: invite.Id}, "Onlyquant-Token", access)
+	require.Equal(t, http.StatusOK, code, string(message))
+
+	code, message = call(t, g, http.MethodGet, "ListInvites", nil, "Onlyquant-Token", access)
+	require.Equal(t, http.StatusOK, code, string(message))
+	assert.JSONEq(t, `{"invites":[]}`, string(message))
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Logout revokes the refresh tokens of the login holding RefreshToken. Its
+// access token stays valid until it expires.
+func (base Base) Logout(c *gin.Context, req *LogoutRequest) *LogoutResponse {
+	revoked, err := model.RevokeRefreshTokenFamily(config.ContextDB(c), middleware.GetUserId(c), service.HashToken(req.RefreshToken))
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	middleware.Audit(c, middleware.GetUserId(c), model.AuditLogout, model.AuditSuccess, "")
+	return &LogoutResponse{Revoked: revoked}
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type LogoutResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// LogoutAll revokes the refresh tokens of every device of the user.
+func (base Base) LogoutAll(c *gin.Context, req *LogoutAllRequest) *LogoutAllResponse {
+	revoked, err := model.RevokeRefreshTokens(config.ContextDB(c), middleware.GetUserId(c))
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	middleware.Audit(c, middleware.GetUserId(c), model.AuditLogout, model.AuditSuccess, "every device")
+	return &LogoutAllResponse{Revoked: revoked}
+}
+
+type LogoutAllRequest struct {
+}
+
+type LogoutAllResponse struct {
+	Revoked int64 `json:"revoked"`
+}
@@ -0,0 +1,335 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ceremonyTtl is how long the user has to answer a passkey prompt
+const ceremonyTtl = 5 * time.Minute
+
+// passkeyUser loads the user userId along with their passkeys. handle is the
+// user handle of a registration, the one of their passkeys otherwise.
+func passkeyUser(db *gorm.DB, userId uint, handle []byte) (*service.PasskeyUser, error) {
+	user := &model.User{}
+	m := model.WhereMap{}
+	m.Eq(model.Id, userId)
+	if err := user.Get(db, m); err != nil {
+		return nil, err
+	}
+	passkeys, err := model.ListPasskeys(db, userId)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := passkeyCredentials(passkeys)
+	if err != nil {
+		return nil, err
+	}
+	if handle == nil && len(passkeys) > 0 {
+		handle = passkeys[0].UserHandle
+	}
+	if handle == nil {
+		if handle, err = service.NewPasskeyHandle(); err != nil {
+			return nil, err
+		}
+	}
+	return &service.PasskeyUser{Id: userId, Handle: handle, Name: user.Email, Credentials: credentials}, nil
+}
+
+func passkeyCredentials(passkeys []model.Passkey) ([]webauthn.Credential, error) {
+	credentials := make([]webauthn.Credential, len(passkeys))
+	for i, passkey := range passkeys {
+		if err := json.Unmarshal(passkey.Credential, &credentials[i]); err != nil {
+			return nil, err
+		}
+	}
+	return credentials, nil
+}
+
+// startCeremony stores the session of a passkey ceremony of userId and returns its id.
+func startCeremony(c *gin.Context, userId uint, session *webauthn.SessionData) (string, error) {
+	id, err := service.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	ceremony := &model.PasskeyCeremony{Id: id, CreatorId: userId, Session: data}
+	return id, model.CreatePasskeyCeremony(config.ContextDB(c), ceremony, ceremonyTtl)
+}
+
+// takeCeremony returns the session of the passkey ceremony id of userId,
+// replying an error when it is unknown or expired.
+func takeCeremony(c *gin.Context, id string, userId uint) *webauthn.SessionData {
+	ceremony, err := model.TakePasskeyCeremony(config.ContextDB(c), id, userId)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if ceremony == nil {
+		handler.Errorf(c, "passkey ceremony is unknown or expired")
+		return nil
+	}
+	session := &webauthn.SessionData{}
+	if err := json.Unmarshal(ceremony.Session, session); err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	return session
+}
+
+// BeginPasskeyRegistration starts adding a passkey to the user. The client
+// passes Options to navigator.credentials.create and the credential it gets
+// to the FinishPasskeyRegistration Action.
+func (base Base) BeginPasskeyRegistration(c *gin.Context, req *BeginPasskeyRegistrationRequest) *BeginPasskeyRegistrationResponse {
+	passkeys, err := service.WebAuthn()
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	userId := middleware.GetUserId(c)
+	user, err := passkeyUser(config.ContextDB(c), userId, nil)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	options, session, err := passkeys.BeginRegistration(user)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	id, err := startCeremony(c, userId, session)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	return &BeginPasskeyRegistrationResponse{CeremonyId: id, Options: options}
+}
+
+type BeginPasskeyRegistrationRequest struct {
+}
+
+type BeginPasskeyRegistrationResponse struct {
+	CeremonyId string                       `json:"ceremonyId"`
+	Options    *protocol.CredentialCreation `json:"options"`
+}
+
+// FinishPasskeyRegistration verifies and stores the passkey created for the
+// options of BeginPasskeyRegistration.
+func (base Base) FinishPasskeyRegistration(c *gin.Context, req *FinishPasskeyRegistrationRequest) *FinishPasskeyRegistrationResponse {
+	passkeys, err := service.WebAuthn()
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	userId := middleware.GetUserId(c)
+	session := takeCeremony(c, req.CeremonyId, userId)
+	if session == nil {
+		return nil
+	}
+	db := config.ContextDB(c)
+	user, err := passkeyUser(db, userId, session.UserID)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	credential, err := passkeys.FinishRegistration(user, *session, req.Credential)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	data, err := json.Marshal(credential)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	passkey := &model.Passkey{
+		CreatorId:    userId,
+		UserHandle:   user.Handle,
+		CredentialId: credential.ID,
+		Name:         req.Name,
+		Credential:   data,
+	}
+	if err := passkey.Create(db); err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	middleware.Audit(c, userId, model.AuditCredentialAdded, model.AuditSuccess, "passkey "+passkey.Id.String())
+	return &FinishPasskeyRegistrationResponse{Passkey: *passkey}
+}
+
+type FinishPasskeyRegistrationRequest struct {
+	CeremonyId string `json:"ceremonyId" binding:"required"`
+	Name       string `json:"name" binding:"required,max=255"`
+	// Credential is the PublicKeyCredential created by the client
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type FinishPasskeyRegistrationResponse struct {
+	model.Passkey
+}
+
+// BeginPasskeyLogin starts signing in with a passkey. The client passes
+// Options to navigator.credentials.get and the assertion it gets to the
+// FinishPasskeyLogin Action.
+func (base Base) BeginPasskeyLogin(c *gin.Context, req *BeginPasskeyLoginRequest) *BeginPasskeyLoginResponse {
+	passkeys, err := service.WebAuthn()
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	options, session, err := passkeys.BeginLogin()
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	id, err := startCeremony(c, 0, session)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	return &BeginPasskeyLoginResponse{CeremonyId: id, Options: options}
+}
+
+type BeginPasskeyLoginRequest struct {
+}
+
+type BeginPasskeyLoginResponse struct {
+	CeremonyId string                        `json:"ceremonyId"`
+	Options    *protocol.CredentialAssertion `json:"options"`
+}
+
+// FinishPasskeyLogin verifies the assertion answering BeginPasskeyLogin and
+// signs its user in with the same tokens as the Auth Action. A refused
+// assertion replies code 401.
+func (base Base) FinishPasskeyLogin(c *gin.Context, req *FinishPasskeyLoginRequest) *FinishPasskeyLoginResponse {
+	passkeys, err := service.WebAuthn()
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	session := takeCeremony(c, req.CeremonyId, 0)
+	if session == nil {
+		return nil
+	}
+	db := config.ContextDB(c)
+	user, credential, err := passkeys.FinishLogin(*session, req.Credential, func(credentialId, handle []byte) (*service.PasskeyUser, error) {
+		registered, err := model.ListPasskeysByHandle(db, handle)
+		if err != nil {
+			return nil, err
+		}
+		if len(registered) == 0 {
+			return nil, errors.New("passkey is not registered")
+		}
+		credentials, err := passkeyCredentials(registered)
+		if err != nil {
+			return nil, err
+		}
+		return &service.PasskeyUser{Id: registered[0].CreatorId, Handle: handle, Credentials: credentials}, nil
+	})
+	if err != nil {
+		middleware.Audit(c, 0, model.AuditLogin, model.AuditFailure, "passkey: "+err.Error())
+		handler.ReplyData(c, http.StatusUnauthorized, err.Error())
+		return nil
+	}
+	data, err := json.Marshal(credential)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if err := model.UpdatePasskeyCredential(db, credential.ID, data); err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+
+	middleware.Audit(c, user.Id, model.AuditLogin, model.AuditSuccess, "passkey")
+	tokens, err := issueTokens(c, user.Id)
+	if err != nil {
+		handler.Errorf(c, "failed to issue tokens: %v", err)
+		return nil
+	}
+	return &FinishPasskeyLoginResponse{Tokens: *tokens}
+}
+
+type FinishPasskeyLoginRequest struct {
+	CeremonyId string `json:"ceremonyId" binding:"required"`
+	// Credential is the PublicKeyCredential asserted by the client
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+type FinishPasskeyLoginResponse struct {
+	Tokens
+}
+
+// ListPasskeys lists the passkeys of the user.
+func (base Base) ListPasskeys(c *gin.Context, req *ListPasskeysRequest) *ListPasskeysResponse {
+	passkeys, err := model.ListPasskeys(config.ContextDB(c), middleware.GetUserId(c))
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	return &ListPasskeysResponse{Passkeys: passkeys}
+}
+
+type ListPasskeysRequest struct {
+}
+
+type ListPasskeysResponse struct {
+	Passkeys []model.Passkey `json:"passkeys"`
+}
+
+// RemovePasskey deletes a passkey of the user, it can no longer sign in. The
+// last way to sign in, a passkey when there is no identity, is kept.
+func (base Base) RemovePasskey(c *gin.Context, req *RemovePasskeyRequest) *RemovePasskeyResponse {
+	db := config.ContextDB(c)
+	userId := middleware.GetUserId(c)
+	passkeys, err := model.ListPasskeys(db, userId)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if len(passkeys) == 1 {
+		identities, err := model.ListUserIdentities(db, userId)
+		if err != nil {
+			handler.Errorf(c, "%s", err.Error())
+			return nil
+		}
+		if len(identities) == 0 {
+			handler.Errorf(c, "can not remove the last way to sign in")
+			return nil
+		}
+	}
+	removed, err := model.DeletePasskey(db, userId, req.Id)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if !removed {
+		handler.Errorf(c, "passkey not found")
+		return nil
+	}
+	middleware.Audit(c, userId, model.AuditCredentialGone, model.AuditSuccess, "passkey "+req.Id.String())
+	return &RemovePasskeyResponse{}
+}
+
+type RemovePasskeyRequest struct {
+	Id uuid.UUID `json:"id" binding:"required"`
+}
+
+type RemovePasskeyResponse struct {
+}
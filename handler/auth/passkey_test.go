@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/EricWvi/dashboard/service/passkeytest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "dashboard.test"
+	testOrigin = "https://dashboard.test"
+)
+
+// ceremonyOptions are the parts of the options of a ceremony an authenticator answers
+type ceremonyOptions struct {
+	CeremonyId string `json:"ceremonyId"`
+	Options    struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				Id string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+func TestPasskeyCeremonies(t *testing.T) {
+	viper.Set("passkey.rpId", testRPID)
+	viper.Set("passkey.rpDisplayName", "Dashboard")
+	viper.Set("passkey.origins", []string{testOrigin})
+	t.Cleanup(func() {
+		viper.Set("passkey.rpId", nil)
+		viper.Set("passkey.rpDisplayName", nil)
+		viper.Set("passkey.origins", nil)
+	})
+	g, db := setupAuthTests(t, &model.User{}, &model.Passkey{}, &model.PasskeyCeremony{},
+		&model.UserIdentity{}, &model.RefreshToken{})
+	user := &model.User{Email: "alice@example.com"}
+	require.NoError(t, db.Create(user).Error)
+	access, _, err := service.IssueAccessToken(testTokenSecret, user.ID, "device-1", time.Minute)
+	require.NoError(t, err)
+	authenticator := passkeytest.New(t, testOrigin)
+
+	var passkey model.Passkey
+	t.Run("a registered passkey is stored", func(t *testing.T) {
+		code, message := call(t, g, http.MethodGet, "BeginPasskeyRegistration", nil, "Onlyquant-Token", access)
+		require.Equal(t, http.StatusOK, code, string(message))
+		var begin ceremonyOptions
+		require.NoError(t, json.Unmarshal(message, &begin))
+		handle, err := base64.RawURLEncoding.DecodeString(begin.Options.PublicKey.User.Id)
+		require.NoError(t, err)
+
+		credential := authenticator.Create(t, testRPID, begin.Options.PublicKey.Challenge, handle)
+		code, message = call(t, g, http.MethodPost, "FinishPasskeyRegistration", map[string]any{
+			"ceremonyId": begin.CeremonyId,
+			"name":       "laptop",
+			"credential": json.RawMessage(credential),
+		}, "Onlyquant-Token", access)
+		require.Equal(t, http.StatusOK, code, string(message))
+		require.NoError(t, json.Unmarshal(message, &passkey))
+		assert.Equal(t, "laptop", passkey.Name)
+	})
+
+	t.Run("the passkey signs in", func(t *testing.T) {
+		code, message := call(t, g, http.MethodGet, "BeginPasskeyLogin", nil)
+		require.Equal(t, http.StatusOK, code, string(message))
+		var begin ceremonyOptions
+		require.NoError(t, json.Unmarshal(message, &begin))
+
+		code, message = call(t, g, http.MethodPost, "FinishPasskeyLogin", map[string]any{
+			"ceremonyId": begin.CeremonyId,
+			"credential": json.RawMessage(authenticator.Get(t, testRPID, begin.Options.PublicKey.Challenge)),
+		}, "Only-Device-Id", "device-2")
+		require.Equal(t, http.StatusOK, code, string(message))
+		var tokens Tokens
+		require.NoError(t, json.Unmarshal(message, &tokens))
+		claims, err := service.ParseAccessToken(testTokenSecret, tokens.Token)
+		require.NoError(t, err)
+		userId, err := claims.UserId()
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, userId)
+		assert.Equal(t, "device-2", claims.DeviceId)
+		assert.Equal(t, "device-2", tokens.DeviceId)
+	})
+
+	t.Run("a ceremony completes once", func(t *testing.T) {
+		code, message := call(t, g, http.MethodGet, "BeginPasskeyLogin", nil)
+		require.Equal(t, http.StatusOK, code, string(message))
+		var begin ceremonyOptions
+		require.NoError(t, json.Unmarshal(message, &begin))
+		credential := json.RawMessage(authenticator.Get(t, testRPID, begin.Options.PublicKey.Challenge))
+
+		code, message = call(t, g, http.MethodPost, "FinishPasskeyLogin", map[string]any{"ceremonyId": begin.CeremonyId, "credential": credential})
+		require.Equal(t, http.StatusOK, code)
+		// a client naming no device gets tokens bound to a new one
+		var tokens Tokens
+		require.NoError(t, json.Unmarshal(message, &tokens))
+		claims, err := service.ParseAccessToken(testTokenSecret, tokens.Token)
+		require.NoError(t, err)
+		assert.NotEmpty(t, claims.DeviceId)
+		assert.Equal(t, tokens.DeviceId, claims.DeviceId)
+		code, _ = call(t, g, http.MethodPost, "FinishPasskeyLogin", map[string]any{"ceremonyId": begin.CeremonyId, "credential": credential})
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("the last way to sign in is kept", func(t *testing.T) {
+		code, _ := call(t, g, http.MethodGet, "RemovePasskey&id="+passkey.Id.String(), nil, "Onlyquant-Token", access)
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+		code, message := call(t, g, http.MethodPost, "RemovePasskey", RemovePasskeyRequest{Id: passkey.Id}, "Onlyquant-Token", access)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.JSONEq(t, `"can not remove the last way to sign in"`, string(message))
+		passkeys, err := model.ListPasskeys(db, user.ID)
+		require.NoError(t, err)
+		assert.Len(t, passkeys, 1)
+	})
+}
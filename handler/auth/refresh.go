@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Refresh exchanges a refresh token for new tokens. Every refresh token is
+// single use: a failure replies code 401 and the device has to sign in again.
+func (base Base) Refresh(c *gin.Context, req *RefreshRequest) *RefreshResponse {
+	refresh, hash, err := service.NewRefreshToken()
+	if err != nil {
+		handler.Errorf(c, "failed to create refresh token: %v", err)
+		return nil
+	}
+	next, err := model.RotateRefreshToken(config.ContextDB(c), service.HashToken(req.RefreshToken), hash, refreshTokenTtl())
+	if errors.Is(err, model.ErrRefreshTokenInvalid) || errors.Is(err, model.ErrRefreshTokenExpired) ||
+		errors.Is(err, model.ErrRefreshTokenReused) {
+		middleware.Audit(c, 0, model.AuditTokenRefresh, model.AuditFailure, err.Error())
+		handler.ReplyData(c, http.StatusUnauthorized, err.Error())
+		return nil
+	}
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+
+	tokens, err := accessTokens(next.CreatorId, next.DeviceId, refresh)
+	if err != nil {
+		handler.Errorf(c, "failed to issue tokens: %v", err)
+		return nil
+	}
+	return &RefreshResponse{
+		Tokens: *tokens,
+	}
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type RefreshResponse struct {
+	Tokens
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+)
+
+// eventTicketTtl is how long an event ticket opens the events stream
+const eventTicketTtl = time.Minute
+
+// CreateEventTicket issues a ticket opening the events stream of the user on
+// their device, sent as the ticket query parameter by clients that cannot send
+// Onlyquant-Token, such as EventSource. See middleware.EventsJWT.
+func (base Base) CreateEventTicket(c *gin.Context, req *CreateEventTicketRequest) *CreateEventTicketResponse {
+	ticket, expiresAt, err := service.IssueEventTicket(service.TokenSecret(),
+		middleware.GetUserId(c), middleware.GetTokenDeviceId(c), eventTicketTtl)
+	if err != nil {
+		handler.Errorf(c, "failed to issue ticket: %v", err)
+		return nil
+	}
+	return &CreateEventTicketResponse{
+		Ticket:    ticket,
+		ExpiresAt: expiresAt.UnixMilli(),
+	}
+}
+
+type CreateEventTicketRequest struct {
+}
+
+type CreateEventTicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/EricWvi/dashboard/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateEventTicket(t *testing.T) {
+	g, _ := setupAuthTests(t)
+	access, _, err := service.IssueAccessToken(testTokenSecret, 7, "device-1", time.Minute)
+	require.NoError(t, err)
+
+	code, _ := call(t, g, http.MethodPost, "CreateEventTicket", CreateEventTicketRequest{})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	var ticket CreateEventTicketResponse
+	code, message := call(t, g, http.MethodPost, "CreateEventTicket", CreateEventTicketRequest{}, "Onlyquant-Token", access)
+	require.Equal(t, http.StatusOK, code, string(message))
+	require.NoError(t, json.Unmarshal(message, &ticket))
+	assert.WithinDuration(t, time.Now().Add(eventTicketTtl), time.UnixMilli(ticket.ExpiresAt), 5*time.Second)
+
+	claims, err := service.ParseEventTicket(testTokenSecret, ticket.Ticket)
+	require.NoError(t, err)
+	userId, err := claims.UserId()
+	require.NoError(t, err)
+	assert.Equal(t, uint(7), userId)
+	assert.Equal(t, "device-1", claims.DeviceId)
+
+	// the ticket opens the events stream and nothing else
+	code, _ = call(t, g, http.MethodPost, "CreateEventTicket", CreateEventTicketRequest{}, "Onlyquant-Token", ticket.Ticket)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
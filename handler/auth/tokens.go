@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// Tokens are the credentials of a signed in device. Token is the access token
+// sent in Onlyquant-Token until ExpiresAt, in milliseconds. RefreshToken is
+// exchanged once for the next Tokens by the Refresh Action. Both are bound to
+// DeviceId, the one the client named in Only-Device-Id when signing in or a
+// new one.
+type Tokens struct {
+	Token        string `json:"token"`
+	ExpiresAt    int64  `json:"expiresAt"`
+	RefreshToken string `json:"refreshToken"`
+	DeviceId     string `json:"deviceId"`
+}
+
+// accessTokenTtl is auth.accessTokenTtl, 15 minutes by default
+func accessTokenTtl() time.Duration {
+	if ttl := viper.GetDuration("auth.accessTokenTtl"); ttl > 0 {
+		return ttl
+	}
+	return 15 * time.Minute
+}
+
+// refreshTokenTtl is auth.refreshTokenTtl, 30 days by default
+func refreshTokenTtl() time.Duration {
+	if ttl := viper.GetDuration("auth.refreshTokenTtl"); ttl > 0 {
+		return ttl
+	}
+	return 30 * 24 * time.Hour
+}
+
+// issueTokens signs userId in with a new refresh token family, bound to the
+// device the client names or to a new one when it names none.
+func issueTokens(c *gin.Context, userId uint) (*Tokens, error) {
+	deviceId := middleware.RequestedDeviceId(c)
+	if deviceId == "" {
+		deviceId = uuid.NewString()
+	}
+	refresh, hash, err := service.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := model.CreateRefreshToken(config.ContextDB(c), userId, deviceId, uuid.Nil, hash, refreshTokenTtl()); err != nil {
+		return nil, err
+	}
+	return accessTokens(userId, deviceId, refresh)
+}
+
+// accessTokens signs an access token to go along with refresh.
+func accessTokens(userId uint, deviceId, refresh string) (*Tokens, error) {
+	access, expiresAt, err := service.IssueAccessToken(service.TokenSecret(), userId, deviceId, accessTokenTtl())
+	if err != nil {
+		return nil, err
+	}
+	return &Tokens{
+		Token:        access,
+		ExpiresAt:    expiresAt.UnixMilli(),
+		RefreshToken: refresh,
+		DeviceId:     deviceId,
+	}, nil
+}
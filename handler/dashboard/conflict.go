@@ -0,0 +1,16 @@
+package dashboard
+
+import (
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/gin-gonic/gin"
+)
+
+func (b Base) ListConflicts(c *gin.Context, req *handler.ListConflictsRequest) *handler.ListConflictsResponse {
+	return handler.SyncListConflicts(c, model.SiteDashboard, middleware.GetUserId(c))
+}
+
+func (b Base) ResolveConflict(c *gin.Context, req *handler.ResolveConflictRequest) *handler.ResolveConflictResponse {
+	return handler.SyncResolveConflict(c, model.SiteDashboard, middleware.GetUserId(c), req)
+}
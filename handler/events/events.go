@@ -0,0 +1,98 @@
+package events
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// changes arriving within the window are sent as one event per site
+	coalesceWindow = 200 * time.Millisecond
+	heartbeat      = 25 * time.Second
+)
+
+type siteEntity struct {
+	Site   string
+	Entity string
+}
+
+// lookup finds the site entities stored in the changed table. A change without
+// table concerns every entity.
+func lookup(change service.SyncChange) []siteEntity {
+	found := make([]siteEntity, 0)
+	for _, site := range model.SyncSites() {
+		for _, e := range site.Entities {
+			if change.Table == "" || (e.Table == change.Table && e.MatchesScope(change.Scope)) {
+				found = append(found, siteEntity{Site: site.Name, Entity: e.Name})
+			}
+		}
+	}
+	return found
+}
+
+type ChangeEvent struct {
+	Site     string   `json:"site"`
+	Entities []string `json:"entities"`
+}
+
+// Stream keeps a Server-Sent Events connection open and sends a "change" event
+// whenever entities of the user advance on the server. The optional site query
+// parameter limits events to one of dashboard, journal and flomo. Clients should
+// pull once connected, every later change is then announced. EventSource, which
+// cannot send Onlyquant-Token, passes a ticket of the CreateEventTicket Action
+// in the ticket query parameter instead, see middleware.EventsJWT.
+func Stream(c *gin.Context) {
+	site := c.Query("site")
+	changes, unsubscribe := service.SubscribeSyncChanges(middleware.GetUserId(c))
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.SSEvent("ready", gin.H{})
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	pending := map[string][]string{}
+	var flush <-chan time.Time
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			for _, e := range lookup(change) {
+				if (site == "" || site == e.Site) && !slices.Contains(pending[e.Site], e.Entity) {
+					pending[e.Site] = append(pending[e.Site], e.Entity)
+				}
+			}
+			if flush == nil && len(pending) > 0 {
+				flush = time.After(coalesceWindow)
+			}
+		case <-flush:
+			for s, ents := range pending {
+				slices.Sort(ents)
+				c.SSEvent("change", ChangeEvent{Site: s, Entities: ents})
+			}
+			c.Writer.Flush()
+			pending = map[string][]string{}
+			flush = nil
+		}
+	}
+}
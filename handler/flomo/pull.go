@@ -1,121 +1,12 @@
 package flomo
 
 import (
-	"sync"
-
-	"github.com/EricWvi/dashboard/config"
 	"github.com/EricWvi/dashboard/handler"
 	"github.com/EricWvi/dashboard/middleware"
 	"github.com/EricWvi/dashboard/model"
 	"github.com/gin-gonic/gin"
 )
 
-func (b Base) Pull(c *gin.Context, req *PullRequest) *PullResponse {
-	userId := middleware.GetUserId(c)
-	db := config.ContextDB(c)
-	serverVersion := req.Since
-
-	var wg sync.WaitGroup
-	var users []model.UserV2View
-	var cards []model.Card
-	var folders []model.Folder
-	var tiptaps []model.TiptapV2
-	var fetchErr error
-
-	// Fetch users in parallel
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		result, err := model.ListUserSince(db, req.Since, userId)
-		if err != nil {
-			fetchErr = err
-			return
-		}
-		users = result
-	}()
-
-	// Fetch cards in parallel
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		result, err := model.ListCardsSince(db, req.Since, userId)
-		if err != nil {
-			fetchErr = err
-			return
-		}
-		cards = result
-	}()
-
-	// Fetch folders in parallel
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		result, err := model.ListFoldersSince(db, req.Since, userId)
-		if err != nil {
-			fetchErr = err
-			return
-		}
-		folders = result
-	}()
-
-	// Fetch tiptaps in parallel
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		result, err := model.ListTiptapV2Since(db, req.Since, userId, model.SiteFlomo)
-		if err != nil {
-			fetchErr = err
-			return
-		}
-		tiptaps = result
-	}()
-
-	wg.Wait()
-
-	if fetchErr != nil {
-		handler.Errorf(c, "failed to fetch data: %s", fetchErr.Error())
-		return nil
-	}
-
-	// Calculate max server version
-	for i := range users {
-		if users[i].ServerVersion > serverVersion {
-			serverVersion = users[i].ServerVersion
-		}
-	}
-	for i := range cards {
-		if cards[i].ServerVersion > serverVersion {
-			serverVersion = cards[i].ServerVersion
-		}
-	}
-	for i := range folders {
-		if folders[i].ServerVersion > serverVersion {
-			serverVersion = folders[i].ServerVersion
-		}
-	}
-	for i := range tiptaps {
-		if tiptaps[i].ServerVersion > serverVersion {
-			serverVersion = tiptaps[i].ServerVersion
-		}
-	}
-
-	return &PullResponse{
-		ServerVersion: serverVersion,
-		User:          users,
-		Card:          cards,
-		Folder:        folders,
-		Tiptap:        tiptaps,
-	}
-}
-
-type PullRequest struct {
-	Since int64 `form:"since" binding:"required"`
-}
-
-type PullResponse struct {
-	ServerVersion int64              `json:"serverVersion"`
-	User          []model.UserV2View `json:"users"`
-	Card          []model.Card       `json:"cards"`
-	Folder        []model.Folder     `json:"folders"`
-	Tiptap        []model.TiptapV2   `json:"tiptaps"`
+func (b Base) Pull(c *gin.Context, req *handler.PullRequest) *handler.SyncResponse {
+	return handler.SyncPull(c, model.SiteFlomo, middleware.GetUserId(c), middleware.GetDevice(c), req)
 }
@@ -0,0 +1,24 @@
+package fullsync
+
+import (
+	"net/http"
+
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/gin-gonic/gin"
+)
+
+// Stream is the streaming variant of the FullSync action of the site named by
+// the site query parameter, one of dashboard, journal and flomo. See
+// handler.SyncFullStream for the format.
+func Stream(c *gin.Context) {
+	name := c.Query("site")
+	for _, site := range model.SyncSites() {
+		if site.Name == name {
+			handler.SyncFullStream(c, site.Id, middleware.GetUserId(c), middleware.GetDevice(c))
+			return
+		}
+	}
+	handler.ReplyError(c, http.StatusNotFound, "unknown site "+name)
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/EricWvi/dashboard/log"
+	"github.com/EricWvi/dashboard/model"
 	"github.com/gin-gonic/gin"
 )
 
@@ -59,11 +60,33 @@ func ReplyString(c *gin.Context, code int, msg string) {
 	})
 }
 
+// ReplyData replies a structured message with the given code and aborts the request.
+func ReplyData(c *gin.Context, code int, data any) {
+	c.JSON(http.StatusOK, Response{
+		RequestId: c.GetString(log.RequestIDCtxKey),
+		Code:      code,
+		Message:   data,
+	})
+	c.Abort()
+}
+
 func Errorf(c *gin.Context, format string, a ...any) {
 	ReplyString(c, http.StatusBadRequest, fmt.Sprintf(format, a...))
 	c.Abort()
 }
 
+// LogPushConflicts records every field that fell back to last-writer-wins
+// while merging pushed records.
+func LogPushConflicts(c *gin.Context, results model.PushResults) {
+	for entity, rs := range results {
+		for _, r := range rs {
+			if len(r.Conflicts) > 0 {
+				log.Warn(c, "push merge conflict", "entity", entity, "id", r.Id, "fields", r.Conflicts)
+			}
+		}
+	}
+}
+
 // ParseDate parses a date string in the format "2006-01-02"
 func ParseDate(dateStr string) (time.Time, error) {
 	return time.Parse("2006-01-02", dateStr)
@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/log"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PushRequest carries the pushed records of a site keyed by entity name.
+type PushRequest map[string]json.RawMessage
+
+type PushResponse struct {
+	Success   bool              `json:"success"`
+	Committed bool              `json:"committed"`
+	Error     string            `json:"error,omitempty"`
+	Results   model.PushResults `json:"results"`
+}
+
+type PullRequest struct {
+	Since int64 `form:"since" binding:"required"`
+	// Limit caps the number of rows returned, 0 returns every change
+	Limit int `form:"limit" binding:"min=0"`
+	// Deltas asks for documents as patches against the version pulled at Since
+	Deltas bool `form:"deltas"`
+}
+
+type FullSyncRequest struct {
+}
+
+// SyncResponse holds the rows of every entity keyed by entity name, along with
+// serverVersion and, for pulls, hasMore.
+type SyncResponse map[string]any
+
+// SyncPush writes a push of the site in one transaction, a failure rolls back the whole push.
+func SyncPush(c *gin.Context, siteId int16, userId uint, device model.DeviceInfo, req *PushRequest) *PushResponse {
+	db := config.ContextDB(c)
+	if !checkSchema(c, device) || !checkDevice(c, db, userId, device) {
+		return nil
+	}
+
+	site := model.GetSyncSite(siteId)
+	results := model.PushResults{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return site.Push(tx, userId, device, *req, results)
+	})
+
+	if err != nil {
+		ReplyData(c, http.StatusBadRequest, &PushResponse{
+			Committed: false,
+			Error:     "failed to push data, nothing was committed: " + err.Error(),
+			Results:   results,
+		})
+		return nil
+	}
+	LogPushConflicts(c, results)
+	if device.Id != "" {
+		if err := model.TouchSyncDevicePush(db, userId, device, siteId); err != nil {
+			log.Errorf(c, "failed to record push of device %s: %v", device.Id, err)
+		}
+	}
+
+	return &PushResponse{
+		Success:   true,
+		Committed: true,
+		Results:   results,
+	}
+}
+
+// FullSyncRequired is replied with http.StatusGone when tombstones the client
+// has not pulled yet were purged, so that it has to full sync.
+type FullSyncRequired struct {
+	Error         string `json:"error"`
+	PurgedVersion int64  `json:"purgedVersion"`
+}
+
+// SyncPull returns the changes of the site since req.Since.
+// A pull acknowledges everything up to req.Since for the device.
+func SyncPull(c *gin.Context, siteId int16, userId uint, device model.DeviceInfo, req *PullRequest) *SyncResponse {
+	db := config.ContextDB(c)
+	if !checkSchema(c, device) || !checkDevice(c, db, userId, device) {
+		return nil
+	}
+	purged, err := model.GetPurgedVersion(db, userId, siteId)
+	if err != nil {
+		Errorf(c, "failed to fetch data: %s", err.Error())
+		return nil
+	}
+	if model.NeedsFullSync(req.Since, purged) {
+		ReplyData(c, http.StatusGone, &FullSyncRequired{
+			Error:         "deleted records since your last pull have been purged, full sync required",
+			PurgedVersion: purged,
+		})
+		return nil
+	}
+	if device.Id != "" {
+		if err := model.TouchSyncDevice(db, userId, device, siteId, req.Since); err != nil {
+			Errorf(c, "failed to register device: %s", err.Error())
+			return nil
+		}
+	}
+
+	site := model.GetSyncSite(siteId)
+	rows, serverVersion, hasMore, err := site.Pull(db, userId, req.Since, req.Limit)
+	if err == nil && req.Deltas {
+		err = site.Diff(db, rows, req.Since)
+	}
+	if err != nil {
+		Errorf(c, "failed to fetch data: %s", err.Error())
+		return nil
+	}
+
+	rsp := SyncResponse(rows)
+	rsp["serverVersion"] = serverVersion
+	rsp["hasMore"] = hasMore
+	return &rsp
+}
+
+// SyncFull returns every live row of the site. Tombstones are left out, so the
+// device is registered as up to date with the returned server version.
+func SyncFull(c *gin.Context, siteId int16, userId uint, device model.DeviceInfo) *SyncResponse {
+	db := config.ContextDB(c)
+	if !checkSchema(c, device) || !checkDevice(c, db, userId, device) {
+		return nil
+	}
+	rows, serverVersion, err := model.GetSyncSite(siteId).Full(db, userId)
+	if err != nil {
+		Errorf(c, "failed to fetch data: %s", err.Error())
+		return nil
+	}
+	if device.Id != "" {
+		if err := model.TouchSyncDevice(db, userId, device, siteId, serverVersion); err != nil {
+			Errorf(c, "failed to register device: %s", err.Error())
+			return nil
+		}
+	}
+
+	rsp := SyncResponse(rows)
+	rsp["serverVersion"] = serverVersion
+	return &rsp
+}
+
+// StreamRecord is a line of a streamed full sync holding one row of Entity.
+type StreamRecord struct {
+	Entity string `json:"entity"`
+	Data   any    `json:"data"`
+}
+
+// StreamTrailer is the last line of a streamed full sync. A stream cut before
+// its trailer, or ending with an Error, is incomplete.
+type StreamTrailer struct {
+	Done          bool   `json:"done"`
+	ServerVersion int64  `json:"serverVersion,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// streamFlushRows is the number of rows written between two flushes
+const streamFlushRows = 100
+
+// SyncFullStream writes every live row of the site as newline-delimited JSON,
+// entity by entity in push order, followed by a StreamTrailer. Unlike SyncFull
+// rows are never loaded all at once, so clients can import them progressively.
+func SyncFullStream(c *gin.Context, siteId int16, userId uint, device model.DeviceInfo) {
+	db := config.ContextDB(c)
+	if !checkSchema(c, device) || !checkDevice(c, db, userId, device) {
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	count := 0
+	serverVersion, err := model.GetSyncSite(siteId).Stream(db, userId, func(entity string, row any) error {
+		if err := enc.Encode(StreamRecord{Entity: entity, Data: row}); err != nil {
+			return err
+		}
+		if count++; count%streamFlushRows == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil && device.Id != "" {
+		err = model.TouchSyncDevice(db, userId, device, siteId, serverVersion)
+	}
+
+	if err != nil {
+		log.Errorf(c, "failed to stream full sync: %v", err)
+		_ = enc.Encode(StreamTrailer{Error: "failed to fetch data: " + err.Error()})
+	} else {
+		_ = enc.Encode(StreamTrailer{Done: true, ServerVersion: serverVersion})
+	}
+	c.Writer.Flush()
+}
+
+type ListConflictsRequest struct {
+}
+
+type ListConflictsResponse struct {
+	Conflicts []model.SyncConflict `json:"conflicts"`
+}
+
+// SyncListConflicts lists the open conflicts of the site, newest first.
+func SyncListConflicts(c *gin.Context, siteId int16, userId uint) *ListConflictsResponse {
+	conflicts, err := model.ListSyncConflicts(config.ContextDB(c), userId, siteId)
+	if err != nil {
+		Errorf(c, "failed to list conflicts: %s", err.Error())
+		return nil
+	}
+	return &ListConflictsResponse{Conflicts: conflicts}
+}
+
+type ResolveConflictRequest struct {
+	Id uuid.UUID `json:"id" binding:"required"`
+	// Pick is client, server or manual
+	Pick string `json:"pick" binding:"required,oneof=client server manual"`
+	// Record is the merged record of a manual resolution
+	Record json.RawMessage `json:"record"`
+}
+
+type ResolveConflictResponse struct {
+	// Result is the push result of the written resolution, empty when the
+	// stored row already holds the picked side
+	Result *model.PushResult `json:"result,omitempty"`
+}
+
+// SyncResolveConflict resolves an open conflict of the site, see
+// model.SyncSite.ResolveSyncConflict.
+func SyncResolveConflict(c *gin.Context, siteId int16, userId uint, req *ResolveConflictRequest) *ResolveConflictResponse {
+	var result *model.PushResult
+	err := config.ContextDB(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = model.GetSyncSite(siteId).ResolveSyncConflict(tx, userId, req.Id, req.Pick, req.Record)
+		return err
+	})
+	if err != nil {
+		Errorf(c, "failed to resolve conflict: %s", err.Error())
+		return nil
+	}
+	return &ResolveConflictResponse{Result: result}
+}
+
+// UnsupportedSchema is replied when the client sync schema is out of the range
+// the server speaks, with http.StatusUpgradeRequired when the client is too old.
+type UnsupportedSchema struct {
+	Error     string `json:"error"`
+	Schema    int    `json:"schema"`
+	MinSchema int    `json:"minSchema"`
+	MaxSchema int    `json:"maxSchema"`
+}
+
+// checkSchema rejects sync calls of clients speaking an unsupported sync schema,
+// or sending a malformed one, and tells every other client the schema of the server.
+func checkSchema(c *gin.Context, device model.DeviceInfo) bool {
+	c.Header("Only-Sync-Schema", strconv.Itoa(model.SyncSchemaMax))
+	rsp := &UnsupportedSchema{
+		Schema:    device.Schema,
+		MinSchema: model.SyncSchemaMin,
+		MaxSchema: model.SyncSchemaMax,
+	}
+	switch {
+	case device.Schema == model.SyncSchemaMalformed:
+		rsp.Error = "Only-Sync-Schema is not a sync schema number"
+		ReplyData(c, http.StatusBadRequest, rsp)
+		return false
+	case device.Schema < model.SyncSchemaMin:
+		rsp.Error = "this client is too old to sync, please upgrade it"
+		ReplyData(c, http.StatusUpgradeRequired, rsp)
+		return false
+	case device.Schema > model.SyncSchemaMax:
+		rsp.Error = "this client is newer than the server, sync schema " + strconv.Itoa(device.Schema) + " is not supported"
+		ReplyData(c, http.StatusBadRequest, rsp)
+		return false
+	}
+	return true
+}
+
+// checkDevice rejects sync calls of revoked devices.
+func checkDevice(c *gin.Context, db *gorm.DB, userId uint, device model.DeviceInfo) bool {
+	if device.Id == "" {
+		return true
+	}
+	err := model.CheckSyncDevice(db, userId, device.Id)
+	if errors.Is(err, model.ErrDeviceRevoked) {
+		ReplyString(c, http.StatusForbidden, err.Error())
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		Errorf(c, "failed to check device: %s", err.Error())
+		return false
+	}
+	return true
+}
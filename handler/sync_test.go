@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EricWvi/dashboard/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSchema(t *testing.T) {
+	check := func(schema int) (bool, int, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodGet, "/", nil)
+		ok := checkSchema(c, model.DeviceInfo{Schema: schema})
+		rsp := Response{}
+		if !ok {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+		}
+		return ok, rsp.Code, w
+	}
+
+	t.Run("Supported schemas sync and learn the schema of the server", func(t *testing.T) {
+		for schema := model.SyncSchemaMin; schema <= model.SyncSchemaMax; schema++ {
+			ok, _, w := check(schema)
+			assert.True(t, ok)
+			assert.Equal(t, "2", w.Header().Get("Only-Sync-Schema"))
+		}
+	})
+
+	t.Run("Clients without the header speak the unversioned schema", func(t *testing.T) {
+		assert.GreaterOrEqual(t, model.SyncSchemaUnversioned, model.SyncSchemaMin)
+		ok, _, _ := check(model.SyncSchemaUnversioned)
+		assert.True(t, ok)
+	})
+
+	t.Run("Older clients are asked to upgrade", func(t *testing.T) {
+		ok, code, _ := check(model.SyncSchemaMin - 1)
+		assert.False(t, ok)
+		assert.Equal(t, http.StatusUpgradeRequired, code)
+	})
+
+	t.Run("Newer and malformed schemas are refused", func(t *testing.T) {
+		ok, code, _ := check(model.SyncSchemaMax + 1)
+		assert.False(t, ok)
+		assert.Equal(t, http.StatusBadRequest, code)
+		ok, code, _ = check(model.SyncSchemaMalformed)
+		assert.False(t, ok)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
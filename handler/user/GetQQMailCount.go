@@ -21,8 +21,10 @@ func (b Base) GetQQMailCount(c *gin.Context, req *GetQQMailCountRequest) *GetQQM
 		return nil
 	}
 	if user.EmailToken != "" && user.EmailFeed != "" {
-		token, err := service.Decrypt(service.Key(), user.EmailToken)
-		if err == nil {
+		token, err := decrypt(c, "email token", user.EmailToken)
+		if err != nil {
+			log.Error(c, err.Error())
+		} else {
 			count, err = service.QQMailUnreadCount(user.EmailFeed, token)
 			if err != nil {
 				log.Error(c, err.Error())
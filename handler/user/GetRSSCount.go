@@ -19,8 +19,10 @@ func (b Base) GetRSSCount(c *gin.Context, req *GetRSSCountRequest) *GetRSSCountR
 		log.Error(c, err.Error())
 	}
 	if tokenField != "" {
-		token, err := service.Decrypt(service.Key(), tokenField)
-		if err == nil {
+		token, err := decrypt(c, "rss token", tokenField)
+		if err != nil {
+			log.Error(c, err.Error())
+		} else {
 			count, err = service.MinifluxUnreadCount(token)
 			if err != nil {
 				log.Error(c, err.Error())
@@ -1,13 +1,14 @@
 package user
 
 import (
-	"github.com/EricWvi/dashboard/middleware"
 	"github.com/gin-gonic/gin"
 )
 
+// GetSessionStatus is kept for older clients. Changes made by other devices
+// are announced on the events stream now, so the session is never stale.
 func (b Base) GetSessionStatus(c *gin.Context, req *GetSessionStatusRequest) *GetSessionStatusResponse {
 	return &GetSessionStatusResponse{
-		Stale: middleware.IsStale(c),
+		Stale: false,
 	}
 }
 
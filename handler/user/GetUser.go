@@ -6,6 +6,7 @@ import (
 	"github.com/EricWvi/dashboard/middleware"
 	"github.com/EricWvi/dashboard/model"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func (b Base) GetUser(c *gin.Context, req *GetUserRequest) *GetUserResponse {
@@ -18,6 +19,12 @@ func (b Base) GetUser(c *gin.Context, req *GetUserRequest) *GetUserResponse {
 		return nil
 	}
 
+	// the session token only identifies the tab for older clients
+	session := c.GetHeader("Only-Session-Token")
+	if session == "" {
+		session = uuid.NewString()
+	}
+
 	return &GetUserResponse{
 		Avatar:        user.Avatar,
 		Username:      user.Username,
@@ -25,7 +32,7 @@ func (b Base) GetUser(c *gin.Context, req *GetUserRequest) *GetUserResponse {
 		HasRssToken:   string(user.RssToken) != "",
 		HasEmailToken: string(user.EmailToken) != "",
 		Language:      user.Language,
-		Session:       middleware.UpdateSession(c),
+		Session:       session,
 		Version:       config.Version,
 		BuildTime:     config.BuildTime,
 	}
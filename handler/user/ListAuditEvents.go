@@ -0,0 +1,38 @@
+package user
+
+import (
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/gin-gonic/gin"
+)
+
+// ListAuditEvents pages through the audit log of the user, newest first. The
+// next page starts before NextBefore, which is 0 on the last page.
+func (b Base) ListAuditEvents(c *gin.Context, req *ListAuditEventsRequest) *ListAuditEventsResponse {
+	events, more, err := model.ListAuditEvents(config.ContextDB(c), middleware.GetUserId(c), req.Before, req.Limit)
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+
+	var next int64
+	if more {
+		next = events[len(events)-1].Id
+	}
+	return &ListAuditEventsResponse{
+		Events:     events,
+		NextBefore: next,
+	}
+}
+
+type ListAuditEventsRequest struct {
+	Before int64 `json:"before"`
+	Limit  int   `json:"limit"`
+}
+
+type ListAuditEventsResponse struct {
+	Events     []model.AuditEvent `json:"events"`
+	NextBefore int64              `json:"nextBefore"`
+}
@@ -0,0 +1,30 @@
+package user
+
+import (
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/gin-gonic/gin"
+)
+
+func (b Base) ListDevices(c *gin.Context, req *ListDevicesRequest) *ListDevicesResponse {
+	devices, err := model.ListSyncDevices(config.ContextDB(c), middleware.GetUserId(c))
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+
+	return &ListDevicesResponse{
+		Devices: devices,
+		Current: middleware.GetDevice(c).Id,
+	}
+}
+
+type ListDevicesRequest struct {
+}
+
+type ListDevicesResponse struct {
+	Devices []model.SyncDevice `json:"devices"`
+	Current string             `json:"current"`
+}
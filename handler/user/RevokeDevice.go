@@ -0,0 +1,42 @@
+package user
+
+import (
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RevokeDevice revokes a device on every site, its later push and pull calls
+// are rejected and it can no longer refresh its access tokens.
+func (b Base) RevokeDevice(c *gin.Context, req *RevokeDeviceRequest) *RevokeDeviceResponse {
+	userId := middleware.GetUserId(c)
+	var found bool
+	err := config.ContextDB(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if found, err = model.RevokeSyncDevice(tx, userId, req.DeviceId); err != nil || !found {
+			return err
+		}
+		_, err = model.RevokeDeviceRefreshTokens(tx, userId, req.DeviceId)
+		return err
+	})
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	if !found {
+		handler.Errorf(c, "device %s not found", req.DeviceId)
+		return nil
+	}
+
+	return &RevokeDeviceResponse{}
+}
+
+type RevokeDeviceRequest struct {
+	DeviceId string `json:"deviceId" binding:"required"`
+}
+
+type RevokeDeviceResponse struct {
+}
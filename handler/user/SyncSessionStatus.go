@@ -1,12 +1,11 @@
 package user
 
 import (
-	"github.com/EricWvi/dashboard/middleware"
 	"github.com/gin-gonic/gin"
 )
 
+// SyncSessionStatus is kept for older clients, see GetSessionStatus.
 func (b Base) SyncSessionStatus(c *gin.Context, req *UpdateSessionStatusRequest) *UpdateSessionStatusResponse {
-	middleware.UpdateSession(c)
 	return &UpdateSessionStatusResponse{}
 }
 
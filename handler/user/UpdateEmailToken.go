@@ -10,7 +10,12 @@ import (
 )
 
 func (b Base) UpdateEmailToken(c *gin.Context, req *UpdateEmailTokenRequest) *UpdateEmailTokenResponse {
-	encryptedToken, err := service.Encrypt(service.Key(), req.EmailToken)
+	keys, err := service.Keys()
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	encryptedToken, err := keys.Encrypt(req.EmailToken)
 	if err != nil {
 		handler.Errorf(c, "%s", err.Error())
 		return nil
@@ -26,6 +31,7 @@ func (b Base) UpdateEmailToken(c *gin.Context, req *UpdateEmailTokenRequest) *Up
 		handler.Errorf(c, "%s", err.Error())
 		return nil
 	}
+	middleware.Audit(c, middleware.GetUserId(c), model.AuditSecretUpdated, model.AuditSuccess, "email token")
 
 	return &UpdateEmailTokenResponse{}
 }
@@ -10,7 +10,12 @@ import (
 )
 
 func (b Base) UpdateRssToken(c *gin.Context, req *UpdateRssTokenRequest) *UpdateRssTokenResponse {
-	encryptedToken, err := service.Encrypt(service.Key(), req.RssToken)
+	keys, err := service.Keys()
+	if err != nil {
+		handler.Errorf(c, "%s", err.Error())
+		return nil
+	}
+	encryptedToken, err := keys.Encrypt(req.RssToken)
 	if err != nil {
 		handler.Errorf(c, "%s", err.Error())
 		return nil
@@ -25,6 +30,7 @@ func (b Base) UpdateRssToken(c *gin.Context, req *UpdateRssTokenRequest) *Update
 		handler.Errorf(c, "%s", err.Error())
 		return nil
 	}
+	middleware.Audit(c, middleware.GetUserId(c), model.AuditSecretUpdated, model.AuditSuccess, "rss token")
 
 	return &UpdateRssTokenResponse{}
 }
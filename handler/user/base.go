@@ -2,6 +2,9 @@ package user
 
 import (
 	"github.com/EricWvi/dashboard/handler"
+	"github.com/EricWvi/dashboard/middleware"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/EricWvi/dashboard/service"
 	"github.com/gin-gonic/gin"
 )
 
@@ -10,3 +13,17 @@ type Base struct{}
 func DefaultHandler(c *gin.Context) {
 	handler.Dispatch(c, Base{})
 }
+
+// decrypt decrypts a credential stored by UpdateRssToken or UpdateEmailToken,
+// what names it in the audit log when it does not decrypt.
+func decrypt(c *gin.Context, what, ciphertext string) (string, error) {
+	keys, err := service.Keys()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := keys.Decrypt(ciphertext)
+	if err != nil {
+		middleware.Audit(c, middleware.GetUserId(c), model.AuditSecretDecrypt, model.AuditFailure, what+": "+err.Error())
+	}
+	return plaintext, err
+}
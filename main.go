@@ -13,6 +13,7 @@ import (
 	"github.com/EricWvi/dashboard/config"
 	"github.com/EricWvi/dashboard/log"
 	"github.com/EricWvi/dashboard/migration"
+	"github.com/EricWvi/dashboard/model"
 	"github.com/EricWvi/dashboard/service"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
@@ -40,14 +41,39 @@ func main() {
 		return
 	}
 
+	// Re-encrypt the stored secrets with the current key, see service.Keyring
+	if len(os.Args) > 1 && os.Args[1] == "reencrypt" {
+		keys, err := service.Keys()
+		if err != nil {
+			log.Fatalf(log.WorkerCtx, "Failed to load encryption keys: %v", err)
+		}
+		rewritten, err := service.ReencryptSecrets(log.WorkerCtx, config.ContextDB(log.WorkerCtx), keys)
+		if err != nil {
+			log.Fatalf(log.WorkerCtx, "Failed to re-encrypt secrets: %v", err)
+		}
+		log.Infof(log.WorkerCtx, "Re-encrypted the secrets of %d users with key %s", rewritten, keys.CurrentKey())
+		return
+	}
+
 	// Run all migrations (normal startup)
 	if err := runMigrations(); err != nil {
 		log.Fatalf(log.WorkerCtx, "Failed to run migrations: %v", err)
 	}
 
+	model.SetClockPolicy(model.ClockPolicy{
+		MaxSkew: viper.GetDuration("sync.maxClockSkew"),
+		Reject:  viper.GetBool("sync.rejectFuture"),
+	})
+	model.SetRegistrationPolicy(model.RegistrationPolicy{
+		Mode:      viper.GetString("registration.policy"),
+		Allowlist: viper.GetStringSlice("registration.allowlist"),
+		Admins:    viper.GetStringSlice("registration.admins"),
+	})
+
 	// Start background workers
 	service.StartRePresignWorker(config.ContextDB(log.MediaCtx))
 	service.StartPruneTiptapHistoryWorker(config.ContextDB(log.WorkerCtx))
+	service.StartSyncNotifyWorker(config.DSN())
 
 	// Set up HTTP server
 	g := gin.New()
@@ -58,6 +84,8 @@ func main() {
 		Addr:    addr,
 		Handler: g,
 	}
+	// end event streams so that Shutdown does not wait for them
+	server.RegisterOnShutdown(service.CloseSyncSubscribers)
 
 	// Start HTTP server in a goroutine
 	go func() {
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/log"
+	"github.com/EricWvi/dashboard/model"
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit appends an audit event, replaced in tests
+var recordAudit = func(c *gin.Context, event *model.AuditEvent) error {
+	return event.Create(config.ContextDB(c))
+}
+
+// anonymousFailures throttles the failures of requests no user is known for,
+// which anyone can send, so that they cannot flood the audit log.
+var anonymousFailures = newFailureThrottle(time.Minute)
+
+// Audit records event of userId, 0 when the user is not known, along with the
+// client of the request, see model.AuditEvent. Failing to record it is logged
+// and does not fail the request. Failures without a user are recorded once per
+// IP and minute, the next recorded one tells how many were left out.
+func Audit(c *gin.Context, userId uint, event, outcome, detail string) {
+	ip := c.ClientIP()
+	if userId == 0 && outcome == model.AuditFailure {
+		record, skipped := anonymousFailures.allow(ip, time.Now())
+		if !record {
+			return
+		}
+		if skipped > 0 {
+			detail = fmt.Sprintf("%s (%d more failures from this ip not recorded)", detail, skipped)
+		}
+	}
+	deviceId := GetDevice(c).Id
+	if deviceId == "" {
+		// sign ins are not authenticated yet
+		deviceId = RequestedDeviceId(c)
+	}
+	record := &model.AuditEvent{
+		CreatorId: userId,
+		Event:     event,
+		Outcome:   outcome,
+		Ip:        ip,
+		UserAgent: c.Request.UserAgent(),
+		DeviceId:  deviceId,
+		Detail:    detail,
+	}
+	if err := recordAudit(c, record); err != nil {
+		log.Errorf(c, "failed to record audit event %s of user %d: %v", event, userId, err)
+	}
+}
+
+// failureThrottle lets one failure per IP through every window and counts the
+// others. IPs that went quiet are forgotten after forget, along with the
+// failures left out.
+type failureThrottle struct {
+	mu      sync.Mutex
+	window  time.Duration
+	forget  time.Duration
+	ips     map[string]*failureWindow
+	sweptAt time.Time
+}
+
+type failureWindow struct {
+	start   time.Time
+	skipped int
+}
+
+func newFailureThrottle(window time.Duration) *failureThrottle {
+	return &failureThrottle{window: window, forget: 60 * window, ips: make(map[string]*failureWindow)}
+}
+
+// allow tells whether a failure from ip at now is recorded, along with how
+// many failures from ip were left out since the last recorded one.
+func (t *failureThrottle) allow(ip string, now time.Time) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if w, ok := t.ips[ip]; ok && now.Sub(w.start) < t.window {
+		w.skipped++
+		return false, 0
+	}
+	skipped := 0
+	if w, ok := t.ips[ip]; ok {
+		skipped = w.skipped
+	}
+	t.ips[ip] = &failureWindow{start: now}
+
+	// forget the ips whose window is over, once per window
+	if now.Sub(t.sweptAt) >= t.window {
+		for other, w := range t.ips {
+			if age := now.Sub(w.start); age >= t.forget || age >= t.window && w.skipped == 0 {
+				delete(t.ips, other)
+			}
+		}
+		t.sweptAt = now
+	}
+	return true, skipped
+}
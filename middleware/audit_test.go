@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureThrottle(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("One failure per ip and window is recorded", func(t *testing.T) {
+		throttle := newFailureThrottle(time.Minute)
+		record, skipped := throttle.allow("10.0.0.1", start)
+		assert.True(t, record)
+		assert.Equal(t, 0, skipped)
+
+		for i := range 3 {
+			record, _ = throttle.allow("10.0.0.1", start.Add(time.Duration(i+1)*time.Second))
+			assert.False(t, record)
+		}
+		record, _ = throttle.allow("10.0.0.2", start.Add(time.Second))
+		assert.True(t, record)
+
+		record, skipped = throttle.allow("10.0.0.1", start.Add(time.Minute))
+		assert.True(t, record)
+		assert.Equal(t, 3, skipped)
+	})
+
+	t.Run("Quiet ips are forgotten", func(t *testing.T) {
+		throttle := newFailureThrottle(time.Minute)
+		throttle.allow("10.0.0.1", start)
+		throttle.allow("10.0.0.2", start)
+		throttle.allow("10.0.0.2", start.Add(time.Second))
+
+		throttle.allow("10.0.0.3", start.Add(2*time.Minute))
+		assert.NotContains(t, throttle.ips, "10.0.0.1")
+		assert.Contains(t, throttle.ips, "10.0.0.2", "left out failures are kept to be reported")
+
+		throttle.allow("10.0.0.3", start.Add(2*time.Hour))
+		assert.NotContains(t, throttle.ips, "10.0.0.2")
+	})
+}
@@ -8,6 +8,7 @@ func CORSMiddleware() gin.HandlerFunc {
 			c.Header("Access-Control-Allow-Origin", "*")
 			c.Header("Access-Control-Allow-Methods", "GET, OPTIONS, POST")
 			c.Header("Access-Control-Allow-Headers", "*")
+			c.Header("Access-Control-Expose-Headers", "Only-Sync-Schema")
 		}
 
 		if c.Request.Method == "OPTIONS" {
@@ -1,130 +1,210 @@
 package middleware
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/EricWvi/dashboard/config"
+	"github.com/EricWvi/dashboard/handler"
 	"github.com/EricWvi/dashboard/log"
+	"github.com/EricWvi/dashboard/model"
 	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
 )
 
-// Simple in-memory cache (like Redis)
-type cacheEntry struct {
-	data      []byte
-	status    int
-	createdAt time.Time
+// IdempotencyStore keeps the requests sent with an Idempotency-Key along with
+// their responses.
+type IdempotencyStore interface {
+	// Claim reserves key of userId for a request with the given fingerprint.
+	// When the key is taken it reports false with the record holding it.
+	Claim(c *gin.Context, userId uint, key, fingerprint string) (*model.IdempotencyRecord, bool, error)
+	// Complete stores the response of the request holding key.
+	Complete(c *gin.Context, userId uint, key string, status int, response []byte) error
+	// Renew extends the lease of the request holding key while it runs. It
+	// reports false when the key is no longer claimed.
+	Renew(c *gin.Context, userId uint, key string) (bool, error)
+	// Release frees key so that a retry runs the request again.
+	Release(c *gin.Context, userId uint, key string) error
 }
 
-var (
-	idemCache = make(map[string]*cacheEntry)
-	mu        sync.RWMutex
+const (
+	// idemLease is how long a request may hold its key without renewing it
+	// before it is considered abandoned, e.g. by a restart
+	idemLease = 2 * time.Minute
+	// idemWait is how long a retry waits for the same request running in this process
+	idemWait = 30 * time.Second
 )
 
-func init() {
-	// start cleanup worker
-	startCacheCleaner(1 * time.Minute)
+// idemRenew is how often a request renews its lease while it runs, well within
+// idemLease so that a slow database does not let it lapse
+var idemRenew = idemLease / 4
+
+// PostgresIdempotency keeps keys in the database for idempotency.ttl, 24 hours
+// by default, so that they survive restarts.
+type PostgresIdempotency struct{}
+
+func (PostgresIdempotency) Claim(c *gin.Context, userId uint, key, fingerprint string) (*model.IdempotencyRecord, bool, error) {
+	ttl := viper.GetDuration("idempotency.ttl")
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return model.ClaimIdempotencyKey(config.ContextDB(c), userId, key, fingerprint, idemLease, ttl)
+}
+
+func (PostgresIdempotency) Complete(c *gin.Context, userId uint, key string, status int, response []byte) error {
+	return model.CompleteIdempotencyKey(config.ContextDB(c), userId, key, status, response)
+}
+
+func (PostgresIdempotency) Renew(c *gin.Context, userId uint, key string) (bool, error) {
+	return model.RenewIdempotencyKey(config.ContextDB(c), userId, key)
 }
 
-func readCache(key string) (*cacheEntry, bool) {
-	mu.RLock()
-	defer mu.RUnlock()
-	entry, ok := idemCache[key]
-	return entry, ok
+func (PostgresIdempotency) Release(c *gin.Context, userId uint, key string) error {
+	return model.ReleaseIdempotencyKey(config.ContextDB(c), userId, key)
 }
 
-// firstWriteCache returns isFirstWrite
-func firstWriteCache(key string, value *cacheEntry) bool {
-	mu.Lock()
-	defer mu.Unlock()
-	if _, ok := idemCache[key]; ok {
-		return false
-	} else {
-		idemCache[key] = value
-		return true
+// running holds a channel per key in flight in this process, closed once it is done
+var (
+	running   = map[string]chan struct{}{}
+	runningMu sync.Mutex
+)
+
+// join takes the key in this process. When it is taken it returns the channel
+// of the request holding it and false.
+func join(key string) (chan struct{}, bool) {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	if ch, ok := running[key]; ok {
+		return ch, false
 	}
+	ch := make(chan struct{})
+	running[key] = ch
+	return ch, true
 }
 
-func checkCache(c *gin.Context, key string) {
-	start := time.Now()
-	if entry, ok := readCache(key); ok {
-		for time.Since(start) < 5*time.Second {
-			if entry.status != -1 {
-				log.Info(c, "idem cache hit")
-				c.Data(entry.status, "application/json", entry.data)
-				c.Abort()
+func leave(key string, ch chan struct{}) {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	delete(running, key)
+	close(ch)
+}
+
+// renew renews the lease of key every interval until done is closed, so that
+// requests running longer than idemLease are not taken over by their retries.
+func renew(c *gin.Context, store IdempotencyStore, userId uint, key string, interval time.Duration, done chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			held, err := store.Renew(c, userId, key)
+			if err != nil {
+				log.Errorf(c, "failed to renew idempotency key: %v", err)
+			} else if !held {
+				log.Warn(c, "idempotency key was taken over while its request ran")
 				return
 			}
-			time.Sleep(500 * time.Millisecond)
 		}
-		log.Error(c, "read idem cache timeout")
-		c.Data(http.StatusInternalServerError, "text/plain", []byte("read idem cache timeout"))
-		c.Abort()
-		return
 	}
 }
 
-// Background job to evict expired keys
-func startCacheCleaner(interval time.Duration) {
-	go func() {
-		for {
-			time.Sleep(interval)
-			count := 0
-			mu.Lock()
-			for k, v := range idemCache {
-				if time.Since(v.createdAt) > 5*time.Minute {
-					delete(idemCache, k)
-					count++
-				}
-			}
-			mu.Unlock()
-			if count > 0 {
-				log.Debugf(log.IdemCtx, "idemCache clean %d keys", count)
-			}
-		}
-	}()
+// fingerprint identifies a request by its method, URL and body.
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
 }
 
-func Idempotency() gin.HandlerFunc {
+// Idempotency replays the response of a POST request retried with the same
+// Idempotency-Key, per user. A key reused for a different request is refused.
+// Failed requests release their key, so that their retry runs again. The key is
+// renewed while the request runs, however long it takes.
+// It needs BodyWriter and JWT to run before it.
+func Idempotency(store IdempotencyStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		key := c.GetHeader("Idempotency-Key")
-		if key == "" {
+		if key == "" || c.Request.Method != http.MethodPost {
 			c.Next()
 			return
 		}
-
 		c.Set(log.RequestIDCtxKey, key)
 
-		// Check cache
-		checkCache(c, key)
-		if c.IsAborted() {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			handler.ReplyError(c, http.StatusInternalServerError, "failed to read request body")
+			c.Abort()
 			return
 		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+		fp := fingerprint(c.Request, body)
+		userId := GetUserId(c)
 
-		isFirstWrite := firstWriteCache(key, &cacheEntry{
-			status:    -1,
-			createdAt: time.Now(),
-		}) // placeholder
-		if !isFirstWrite {
-			checkCache(c, key)
+		// retries reaching this process while the request runs wait for it
+		local := strconv.FormatUint(uint64(userId), 10) + ":" + key
+		ch, first := join(local)
+		for !first {
+			select {
+			case <-ch:
+			case <-time.After(idemWait):
+				handler.ReplyError(c, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+				c.Abort()
+				return
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+			ch, first = join(local)
+		}
+		defer leave(local, ch)
+
+		record, claimed, err := store.Claim(c, userId, key, fp)
+		if err != nil {
+			log.Errorf(c, "failed to claim idempotency key: %v", err)
+			handler.ReplyError(c, http.StatusInternalServerError, "failed to check Idempotency-Key")
+			c.Abort()
+			return
+		}
+		if !claimed {
+			switch {
+			case record == nil || record.Status == 0 && record.Fingerprint == fp:
+				handler.ReplyError(c, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+			case record.Fingerprint != fp:
+				handler.ReplyError(c, http.StatusUnprocessableEntity, "Idempotency-Key was used for a different request")
+			default:
+				log.Info(c, "idempotency key hit")
+				c.Data(record.Status, "application/json", record.Response)
+			}
+			c.Abort()
 			return
 		}
 
+		done, renewed := make(chan struct{}), make(chan struct{})
+		cp := c.Copy()
+		go func() {
+			renew(cp, store, userId, key, idemRenew, done)
+			close(renewed)
+		}()
 		c.Next()
+		close(done)
+		<-renewed
 
-		mu.Lock()
-		defer mu.Unlock()
-		if entry, ok := idemCache[key]; ok {
-			if c.IsAborted() {
-				entry.data = []byte(`"previous request failed"`)
-				entry.status = http.StatusInternalServerError
-			} else {
-				writer, _ := c.Get("bodyWriter")
-				rspBody := writer.(*bodyWriter).body.Bytes()
-				entry.data = rspBody
-				entry.status = c.Writer.Status()
-				entry.createdAt = time.Now()
-			}
+		if c.IsAborted() || c.Writer.Status() >= http.StatusInternalServerError {
+			err = store.Release(c, userId, key)
+		} else {
+			writer, _ := c.Get("bodyWriter")
+			err = store.Complete(c, userId, key, c.Writer.Status(), writer.(*bodyWriter).body.Bytes())
+		}
+		if err != nil {
+			log.Errorf(c, "failed to store idempotency key: %v", err)
 		}
 	}
 }
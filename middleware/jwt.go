@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"os"
+	"strconv"
 	"sync"
 
 	"github.com/EricWvi/dashboard/config"
@@ -11,6 +13,8 @@ import (
 	"github.com/EricWvi/dashboard/model"
 	"github.com/EricWvi/dashboard/service"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
 )
 
 var emailToID map[string]uint
@@ -33,58 +37,275 @@ func readMap(email string) (uint, bool) {
 	return id, ok
 }
 
-func writeMap(email string) uint {
+// writeMap signs in the user with email, registering them when the
+// registration policy allows it, see model.SignInUser. It tells whether the
+// user was registered.
+func writeMap(email string) (uint, bool, error) {
 	lock.Lock()
 	defer lock.Unlock()
 	if id, ok := emailToID[email]; ok {
-		return id
-	} else {
-		id, err := model.CreateUser(config.ContextDB(log.WorkerCtx), email)
-		if err != nil {
-			log.Error(log.WorkerCtx, err.Error())
-		}
-		emailToID[email] = id
-		return id
+		return id, false, nil
 	}
+	id, created, err := model.SignInUser(config.ContextDB(log.WorkerCtx), email, "")
+	if err != nil {
+		return 0, false, err
+	}
+	emailToID[email] = id
+	return id, created, nil
 }
 
-func getId(email string) uint {
+func getId(email string) (uint, bool, error) {
 	if id, ok := readMap(email); ok {
-		return id
-	} else {
-		return writeMap(email)
+		return id, false, nil
 	}
+	return writeMap(email)
 }
 
+// publicActions are served without a token by the auth route, they sign the
+// user in. Other routes require a token whatever their Action.
+var publicActions = map[string]bool{
+	"Login":              true,
+	"Auth":               true,
+	"Refresh":            true,
+	"ListProviders":      true,
+	"BeginPasskeyLogin":  true,
+	"FinishPasskeyLogin": true,
+}
+
+// JWT authenticates the access token sent in Onlyquant-Token, see
+// service.IssueAccessToken, or a personal access token limited to its scopes.
+// Tokens issued before access tokens, an encrypted email that never expires,
+// are only accepted by the ExchangeLegacyToken Action, as long as
+// auth.acceptLegacyTokens is set, so that clients can exchange them. See
+// UsesLegacyToken.
 func JWT() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.Request.Header.Get("Onlyquant-Token")
+		action := c.Request.URL.Query().Get("Action")
+		if publicActions[action] && authRoute(c) {
+			c.Set("UserId", uint(0))
+			// the user signed in already, e.g. completing an identity link, is
+			// known from a valid access token sent along
+			if token != "" {
+				if claims, err := service.ParseAccessToken(service.TokenSecret(), token); err == nil {
+					if userId, err := claims.UserId(); err == nil {
+						c.Set("UserId", userId)
+						c.Set("TokenDeviceId", claims.DeviceId)
+					}
+				}
+			}
+			return
+		}
 		if token == "" {
-			if c.Request.URL.Query().Get("Action") != "Auth" {
-				handler.ReplyError(c, http.StatusBadRequest, "request is not authenticated")
+			handler.ReplyError(c, http.StatusBadRequest, "request is not authenticated")
+			c.Abort()
+			return
+		}
+
+		if service.IsPersonalToken(token) {
+			personal(c, token)
+			return
+		}
+
+		if service.IsLegacyToken(token) {
+			if !viper.GetBool("auth.acceptLegacyTokens") {
+				handler.ReplyError(c, http.StatusUnauthorized, "token is no longer accepted, sign in again")
+				c.Abort()
+				return
+			}
+			if action != "ExchangeLegacyToken" {
+				handler.ReplyError(c, http.StatusUnauthorized, "exchange your token with the ExchangeLegacyToken Action")
 				c.Abort()
 				return
-			} else {
-				c.Set("UserId", uint(0))
+			}
+			keys, err := service.Keys()
+			if err != nil {
+				log.Errorf(c, "failed to load encryption keys: %v", err)
+				handler.ReplyError(c, http.StatusInternalServerError, "failed to check token")
+				c.Abort()
+				return
+			}
+			email, err := keys.Decrypt(token)
+			if err != nil {
+				Audit(c, 0, model.AuditTokenInvalid, model.AuditFailure, "legacy token does not decrypt")
+				handler.ReplyError(c, http.StatusBadRequest, "token is invalid")
+				c.Abort()
 				return
 			}
+			if len(email) == 0 {
+				handler.ReplyError(c, http.StatusBadRequest, "email is empty")
+				c.Abort()
+				return
+			}
+			id, created, err := getId(email)
+			if err != nil {
+				registrationError(c, err)
+				return
+			}
+			if created {
+				Audit(c, id, model.AuditUserCreated, model.AuditSuccess, "legacy token")
+			}
+			c.Set("UserId", id)
+			c.Set("LegacyToken", true)
+			return
+		}
+
+		claims, err := service.ParseAccessToken(service.TokenSecret(), token)
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			handler.ReplyError(c, http.StatusUnauthorized, "token is expired")
+			c.Abort()
+			return
 		}
-		email, err := service.Decrypt(service.Key(), token)
 		if err != nil {
+			Audit(c, 0, model.AuditTokenInvalid, model.AuditFailure, "access token: "+err.Error())
 			handler.ReplyError(c, http.StatusBadRequest, "token is invalid")
 			c.Abort()
 			return
 		}
-		if len(email) == 0 {
-			handler.ReplyError(c, http.StatusBadRequest, "email is empty")
+		userId, err := claims.UserId()
+		if err != nil {
+			handler.ReplyError(c, http.StatusBadRequest, err.Error())
 			c.Abort()
 			return
-		} else {
-			c.Set("UserId", getId(email))
 		}
+		// a token bound to a device only works for that device, so that revoking
+		// it cannot be sidestepped by sending another device id
+		if h := c.GetHeader("Only-Device-Id"); claims.DeviceId != "" && h != "" && h != claims.DeviceId {
+			handler.ReplyError(c, http.StatusForbidden, "device does not match the token")
+			c.Abort()
+			return
+		}
+		c.Set("UserId", userId)
+		c.Set("TokenDeviceId", claims.DeviceId)
 	}
 }
 
+// EventsJWT authenticates the events stream like JWT, or by the ticket query
+// parameter when no Onlyquant-Token is sent, since EventSource cannot send
+// headers. Tickets are issued by the CreateEventTicket Action, see
+// service.IssueEventTicket, and only open a stream within a minute: clients
+// fetch a new one to reconnect.
+func EventsJWT() gin.HandlerFunc {
+	authenticate := JWT()
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" || c.GetHeader("Onlyquant-Token") != "" {
+			authenticate(c)
+			return
+		}
+
+		claims, err := service.ParseEventTicket(service.TokenSecret(), ticket)
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			handler.ReplyError(c, http.StatusUnauthorized, "ticket is expired")
+			c.Abort()
+			return
+		}
+		if err != nil {
+			Audit(c, 0, model.AuditTokenInvalid, model.AuditFailure, "event ticket: "+err.Error())
+			handler.ReplyError(c, http.StatusBadRequest, "ticket is invalid")
+			c.Abort()
+			return
+		}
+		userId, err := claims.UserId()
+		if err != nil {
+			handler.ReplyError(c, http.StatusBadRequest, err.Error())
+			c.Abort()
+			return
+		}
+		c.Set("UserId", userId)
+		c.Set("TokenDeviceId", claims.DeviceId)
+	}
+}
+
+// authRoute tells whether the request goes to the auth route.
+func authRoute(c *gin.Context) bool {
+	return c.Request.URL.Path == viper.GetString("route.back.base")+"/auth"
+}
+
+// registrationError replies why a user could not be signed in.
+func registrationError(c *gin.Context, err error) {
+	if errors.Is(err, model.ErrNotAllowlisted) || errors.Is(err, model.ErrInviteRequired) {
+		Audit(c, 0, model.AuditLogin, model.AuditFailure, err.Error())
+		handler.ReplyError(c, http.StatusForbidden, err.Error())
+	} else {
+		log.Error(c, err.Error())
+		handler.ReplyError(c, http.StatusInternalServerError, "failed to sign in")
+	}
+	c.Abort()
+}
+
+// personal authenticates a personal access token, limited to the scopes it
+// was granted for the requested route and Action.
+func personal(c *gin.Context, token string) {
+	pat, err := model.FindAccessToken(config.ContextDB(c), service.HashToken(token))
+	if err != nil {
+		log.Errorf(c, "failed to find access token: %v", err)
+		handler.ReplyError(c, http.StatusInternalServerError, "failed to check token")
+		c.Abort()
+		return
+	}
+	if pat == nil {
+		Audit(c, 0, model.AuditTokenInvalid, model.AuditFailure, "personal access token is revoked or expired")
+		handler.ReplyError(c, http.StatusUnauthorized, "token is revoked or expired")
+		c.Abort()
+		return
+	}
+	scope, ok := requiredScope(c)
+	if !ok {
+		handler.ReplyError(c, http.StatusForbidden, "request is not available to access tokens")
+		c.Abort()
+		return
+	}
+	if !scopeAllows(pat.Scopes, scope) {
+		handler.ReplyError(c, http.StatusForbidden, "token lacks scope "+scope)
+		c.Abort()
+		return
+	}
+	c.Set("UserId", pat.CreatorId)
+	c.Set("AccessTokenId", pat.Id.String())
+}
+
+// UsesLegacyToken tells whether the request was authenticated by a legacy token.
+func UsesLegacyToken(c *gin.Context) bool {
+	return c.GetBool("LegacyToken")
+}
+
+// GetTokenDeviceId returns the device the access token was issued to.
+func GetTokenDeviceId(c *gin.Context) string {
+	return c.GetString("TokenDeviceId")
+}
+
+// RequestedDeviceId returns the device the client names in Only-Device-Id.
+// It only chooses the device tokens are bound to when they are issued, see
+// GetDevice.
+func RequestedDeviceId(c *gin.Context) string {
+	return c.GetHeader("Only-Device-Id")
+}
+
 func GetUserId(c *gin.Context) uint {
 	return c.GetUint("UserId")
 }
+
+// GetDevice returns the client install sent in the Only-Device-* headers.
+// Its Id is the device the access token was issued to, whatever the client
+// sends, so that revoking a device does not depend on the client naming it.
+// It is empty for personal access tokens and tokens issued before they were
+// bound to a device. Clients predating the
+// Only-Sync-Schema header speak model.SyncSchemaUnversioned, a header that is
+// not a schema number gives model.SyncSchemaMalformed.
+func GetDevice(c *gin.Context) model.DeviceInfo {
+	schema := model.SyncSchemaUnversioned
+	if h := c.GetHeader("Only-Sync-Schema"); h != "" {
+		var err error
+		if schema, err = strconv.Atoi(h); err != nil || schema < 0 {
+			schema = model.SyncSchemaMalformed
+		}
+	}
+	return model.DeviceInfo{
+		Id:       GetTokenDeviceId(c),
+		Name:     c.GetHeader("Only-Device-Name"),
+		Platform: c.GetHeader("Only-Device-Platform"),
+		Ip:       c.ClientIP(),
+		Schema:   schema,
+	}
+}
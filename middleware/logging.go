@@ -3,6 +3,7 @@ package middleware
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"slices"
@@ -14,7 +15,8 @@ import (
 	"github.com/google/uuid"
 )
 
-var noLoggingActions = []string{"UpdateTiptap"}
+// noLoggingActions are not logged with their body, which is large or carries a secret
+var noLoggingActions = []string{"UpdateTiptap", "Refresh", "Logout"}
 
 func shouldLogging(action string) bool {
 	return !slices.Contains(noLoggingActions, action)
@@ -79,7 +81,11 @@ func Logging() gin.HandlerFunc {
 				"latency", latency,
 			}
 			if rsp.Code >= 400 {
-				log.Info(c, rsp.Message.(string), fields...)
+				msg, ok := rsp.Message.(string)
+				if !ok {
+					msg = fmt.Sprintf("%v", rsp.Message)
+				}
+				log.Info(c, msg, fields...)
 			} else {
 				log.Info(c, "ok", fields...)
 			}
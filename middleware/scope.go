@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// scopedResources are the routes personal access tokens can be granted, as
+// <resource>:read and <resource>:write. Signing in and managing tokens is not
+// one of them.
+var scopedResources = []string{
+	"blog", "bookmark", "collection", "dashboard", "echo", "entry", "flomo",
+	"journal", "media", "tiptap", "todo", "user", "watch",
+}
+
+// ScopeMediaUpload grants the upload route
+const ScopeMediaUpload = "media:upload"
+
+// readActions are the Actions only reading data, besides those named Get*, List* and Search*
+var readActions = []string{"Pull", "FullSync"}
+
+// Scopes lists every scope a personal access token can be granted.
+func Scopes() []string {
+	scopes := make([]string, 0, 2*len(scopedResources)+1)
+	for _, resource := range scopedResources {
+		scopes = append(scopes, resource+":read", resource+":write")
+	}
+	return append(scopes, ScopeMediaUpload)
+}
+
+// requiredScope returns the scope needed to serve the request, false when it
+// can not be served to personal access tokens. Actions are reads when their
+// name says so, whatever the method they are sent with.
+func requiredScope(c *gin.Context) (string, bool) {
+	route, ok := strings.CutPrefix(c.Request.URL.Path, viper.GetString("route.back.base")+"/")
+	if !ok {
+		return "", false
+	}
+	switch {
+	case route == "upload":
+		return ScopeMediaUpload, true
+	case strings.HasPrefix(route, "m/"):
+		return "media:read", true
+	case !slices.Contains(scopedResources, route):
+		return "", false
+	}
+
+	action := c.Request.URL.Query().Get("Action")
+	if action == "" {
+		return "", false
+	}
+	for _, prefix := range []string{"Get", "List", "Search"} {
+		if strings.HasPrefix(action, prefix) {
+			return route + ":read", true
+		}
+	}
+	if slices.Contains(readActions, action) {
+		return route + ":read", true
+	}
+	return route + ":write", true
+}
+
+// scopeAllows tells whether scopes grant required. Writing a resource
+// includes reading it.
+func scopeAllows(scopes []string, required string) bool {
+	if slices.Contains(scopes, required) {
+		return true
+	}
+	resource, access, _ := strings.Cut(required, ":")
+	return access == "read" && slices.Contains(scopes, resource+":write")
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func scopeContext(method, target string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest(method, target, nil)
+	return c
+}
+
+func TestRequiredScope(t *testing.T) {
+	viper.Set("route.back.base", "/api")
+	t.Cleanup(func() { viper.Set("route.back.base", nil) })
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		expected string
+		allowed  bool
+	}{
+		{"Get action reads", "GET", "/api/todo?Action=GetTodo", "todo:read", true},
+		{"List action reads", "GET", "/api/journal?Action=ListEntries", "journal:read", true},
+		{"Pull reads", "POST", "/api/entry?Action=Pull", "entry:read", true},
+		{"Other actions write", "POST", "/api/todo?Action=CreateTodo", "todo:write", true},
+		{"Write action sent with GET still writes", "GET", "/api/todo?Action=DeleteTodo", "todo:write", true},
+		{"Upload", "POST", "/api/upload", ScopeMediaUpload, true},
+		{"Media link reads media", "GET", "/api/m/abc", "media:read", true},
+		{"Auth is refused", "POST", "/api/auth?Action=CreateAccessToken", "", false},
+		{"Sync events are refused", "GET", "/api/events", "", false},
+		{"Missing action is refused", "GET", "/api/todo", "", false},
+		{"Other routes are refused", "GET", "/todo?Action=GetTodo", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, ok := requiredScope(scopeContext(tt.method, tt.target))
+			assert.Equal(t, tt.allowed, ok)
+			assert.Equal(t, tt.expected, scope)
+		})
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	assert.True(t, scopeAllows([]string{"todo:read"}, "todo:read"))
+	assert.True(t, scopeAllows([]string{"todo:write"}, "todo:read"))
+	assert.False(t, scopeAllows([]string{"todo:read"}, "todo:write"))
+	assert.False(t, scopeAllows([]string{"journal:write"}, "todo:read"))
+	assert.False(t, scopeAllows([]string{"media:write"}, ScopeMediaUpload))
+	assert.False(t, scopeAllows(nil, "todo:read"))
+}
+
+func TestScopes(t *testing.T) {
+	scopes := Scopes()
+	assert.Contains(t, scopes, "todo:write")
+	assert.Contains(t, scopes, "journal:read")
+	assert.Contains(t, scopes, ScopeMediaUpload)
+	assert.NotContains(t, scopes, "auth:read")
+}
@@ -1,6 +1,8 @@
 package migration
 
 import (
+	"fmt"
+
 	"gorm.io/gorm"
 )
 
@@ -37,9 +39,593 @@ func GetAllMigrations() []MigrationStep {
 			Up:      AddStatisticTable,
 			Down:    RemoveStatisticTable,
 		},
+		{
+			Version: "v2.12.0",
+			Name:    "Add sync revision table",
+			Up:      AddSyncRevisionTable,
+			Down:    RemoveSyncRevisionTable,
+		},
+		{
+			Version: "v2.13.0",
+			Name:    "Notify sync changes",
+			Up:      AddSyncChangeNotify,
+			Down:    RemoveSyncChangeNotify,
+		},
+		{
+			Version: "v2.14.0",
+			Name:    "Add sync device and purge tables",
+			Up:      AddSyncDevicePurgeTables,
+			Down:    RemoveSyncDevicePurgeTables,
+		},
+		{
+			Version: "v2.15.0",
+			Name:    "Add sync device details",
+			Up:      AddSyncDeviceDetails,
+			Down:    RemoveSyncDeviceDetails,
+		},
+		{
+			Version: "v2.16.0",
+			Name:    "Add tiptap revisions",
+			Up:      AddTiptapRevision,
+			Down:    RemoveTiptapRevision,
+		},
+		{
+			Version: "v2.17.0",
+			Name:    "Add hybrid logical clock column",
+			Up:      AddHlcColumn,
+			Down:    RemoveHlcColumn,
+		},
+		{
+			Version: "v2.18.0",
+			Name:    "Add sync conflict table",
+			Up:      AddSyncConflictTable,
+			Down:    RemoveSyncConflictTable,
+		},
+		{
+			Version: "v2.19.0",
+			Name:    "Add idempotency table",
+			Up:      AddIdempotencyTable,
+			Down:    RemoveIdempotencyTable,
+		},
+		{
+			Version: "v2.20.0",
+			Name:    "Add refresh token table",
+			Up:      AddRefreshTokenTable,
+			Down:    RemoveRefreshTokenTable,
+		},
+		{
+			Version: "v2.21.0",
+			Name:    "Add oidc login table",
+			Up:      AddOIDCLoginTable,
+			Down:    RemoveOIDCLoginTable,
+		},
+		{
+			Version: "v2.22.0",
+			Name:    "Add access token table",
+			Up:      AddAccessTokenTable,
+			Down:    RemoveAccessTokenTable,
+		},
+		{
+			Version: "v2.23.0",
+			Name:    "Add invite table",
+			Up:      AddInviteTable,
+			Down:    RemoveInviteTable,
+		},
+		{
+			Version: "v2.24.0",
+			Name:    "Add passkey tables",
+			Up:      AddPasskeyTables,
+			Down:    RemovePasskeyTables,
+		},
+		{
+			Version: "v2.25.0",
+			Name:    "Add user identity table",
+			Up:      AddUserIdentityTable,
+			Down:    RemoveUserIdentityTable,
+		},
+		{
+			Version: "v2.26.0",
+			Name:    "Add audit event table",
+			Up:      AddAuditEventTable,
+			Down:    RemoveAuditEventTable,
+		},
+		{
+			Version: "v2.27.0",
+			Name:    "Allow sync devices that never pulled",
+			Up:      AllowPushOnlySyncDevices,
+			Down:    DisallowPushOnlySyncDevices,
+		},
+		{
+			Version: "v2.28.0",
+			Name:    "Add idempotency lease renewal",
+			Up:      AddIdempotencyRenewedAt,
+			Down:    RemoveIdempotencyRenewedAt,
+		},
 	}
 }
 
+// ------------------- v2.28.0 -------------------
+func AddIdempotencyRenewedAt(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE public.d_idempotency ADD COLUMN renewed_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL;
+		UPDATE public.d_idempotency SET renewed_at = created_at;
+	`).Error
+}
+
+func RemoveIdempotencyRenewedAt(db *gorm.DB) error {
+	return db.Exec(`ALTER TABLE public.d_idempotency DROP COLUMN IF EXISTS renewed_at;`).Error
+}
+
+// ------------------- v2.27.0 -------------------
+func AllowPushOnlySyncDevices(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE public.d_sync_device ALTER COLUMN last_pull_at DROP DEFAULT;
+		ALTER TABLE public.d_sync_device ALTER COLUMN last_pull_at DROP NOT NULL;
+
+		-- Devices which pushed but never pulled past version 0 acknowledged nothing
+		UPDATE public.d_sync_device SET last_pull_at = NULL
+		WHERE pulled_version = 0 AND last_push_at IS NOT NULL;
+	`).Error
+}
+
+func DisallowPushOnlySyncDevices(db *gorm.DB) error {
+	return db.Exec(`
+		UPDATE public.d_sync_device SET last_pull_at = COALESCE(last_push_at, now())
+		WHERE last_pull_at IS NULL;
+		ALTER TABLE public.d_sync_device ALTER COLUMN last_pull_at SET NOT NULL;
+		ALTER TABLE public.d_sync_device ALTER COLUMN last_pull_at SET DEFAULT now();
+	`).Error
+}
+
+// ------------------- v2.26.0 -------------------
+func AddAuditEventTable(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_audit_event (
+			id bigserial PRIMARY KEY,
+			creator_id int4 DEFAULT 0 NOT NULL,
+			event varchar(32) NOT NULL,
+			outcome varchar(16) NOT NULL,
+			ip varchar(64) DEFAULT '' NOT NULL,
+			user_agent varchar(512) DEFAULT '' NOT NULL,
+			device_id varchar(64) DEFAULT '' NOT NULL,
+			detail varchar(255) DEFAULT '' NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL
+		);
+		CREATE INDEX idx_audit_event_creator ON public.d_audit_event USING btree (creator_id, id);
+		CREATE INDEX idx_audit_event_created_at ON public.d_audit_event USING btree (created_at);
+
+		-- Events are append-only, they are only deleted once past retention
+		CREATE OR REPLACE FUNCTION audit_event_append_only()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			RAISE EXCEPTION 'd_audit_event is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+
+		CREATE TRIGGER trg_audit_event_append_only
+		BEFORE UPDATE ON public.d_audit_event
+		FOR EACH ROW EXECUTE FUNCTION audit_event_append_only();
+	`).Error
+}
+
+func RemoveAuditEventTable(db *gorm.DB) error {
+	return db.Exec(`
+		DROP TABLE IF EXISTS public.d_audit_event CASCADE;
+		DROP FUNCTION IF EXISTS audit_event_append_only;
+	`).Error
+}
+
+// ------------------- v2.25.0 -------------------
+func AddUserIdentityTable(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_user_identity (
+			provider varchar(64) NOT NULL,
+			subject varchar(255) NOT NULL,
+			creator_id int4 NOT NULL,
+			email varchar(100) DEFAULT '' NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			last_login_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			PRIMARY KEY (provider, subject)
+		);
+		CREATE INDEX idx_user_identity_creator ON public.d_user_identity USING btree (creator_id);
+
+		ALTER TABLE public.d_oidc_login
+			ADD COLUMN provider varchar(64) DEFAULT '' NOT NULL,
+			ADD COLUMN link_user_id int4 DEFAULT 0 NOT NULL;
+	`).Error
+}
+
+func RemoveUserIdentityTable(db *gorm.DB) error {
+	return db.Exec(`
+		ALTER TABLE public.d_oidc_login
+			DROP COLUMN IF EXISTS provider,
+			DROP COLUMN IF EXISTS link_user_id;
+		DROP TABLE IF EXISTS public.d_user_identity CASCADE;
+	`).Error
+}
+
+// ------------------- v2.24.0 -------------------
+func AddPasskeyTables(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_passkey (
+			id UUID PRIMARY KEY,
+			creator_id int4 NOT NULL,
+			user_handle bytea NOT NULL,
+			credential_id bytea NOT NULL,
+			name varchar(255) NOT NULL,
+			credential jsonb NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			last_used_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE UNIQUE INDEX idx_passkey_credential_id ON public.d_passkey USING btree (credential_id);
+		CREATE INDEX idx_passkey_creator ON public.d_passkey USING btree (creator_id);
+		CREATE INDEX idx_passkey_user_handle ON public.d_passkey USING btree (user_handle);
+
+		CREATE TABLE public.d_passkey_ceremony (
+			id varchar(64) PRIMARY KEY,
+			creator_id int4 DEFAULT 0 NOT NULL,
+			session jsonb NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+		CREATE INDEX idx_passkey_ceremony_expires_at ON public.d_passkey_ceremony USING btree (expires_at);
+	`).Error
+}
+
+func RemovePasskeyTables(db *gorm.DB) error {
+	return db.Exec(`
+		DROP TABLE IF EXISTS public.d_passkey_ceremony CASCADE;
+		DROP TABLE IF EXISTS public.d_passkey CASCADE;
+	`).Error
+}
+
+// ------------------- v2.23.0 -------------------
+func AddInviteTable(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_invite (
+			id UUID PRIMARY KEY,
+			creator_id int4 NOT NULL,
+			prefix varchar(16) NOT NULL,
+			code_hash varchar(64) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE,
+			used_at TIMESTAMP WITH TIME ZONE,
+			used_by int4 DEFAULT 0 NOT NULL
+		);
+		CREATE UNIQUE INDEX idx_invite_code_hash ON public.d_invite USING btree (code_hash);
+		CREATE INDEX idx_invite_creator ON public.d_invite USING btree (creator_id);
+	`).Error
+}
+
+func RemoveInviteTable(db *gorm.DB) error {
+	return db.Exec(`DROP TABLE IF EXISTS public.d_invite CASCADE;`).Error
+}
+
+// ------------------- v2.22.0 -------------------
+func AddAccessTokenTable(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_access_token (
+			id UUID PRIMARY KEY,
+			creator_id int4 NOT NULL,
+			name varchar(255) NOT NULL,
+			prefix varchar(16) NOT NULL,
+			token_hash varchar(64) NOT NULL,
+			scopes jsonb DEFAULT '[]'::jsonb NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE,
+			last_used_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE UNIQUE INDEX idx_access_token_hash ON public.d_access_token USING btree (token_hash);
+		CREATE INDEX idx_access_token_creator ON public.d_access_token USING btree (creator_id);
+	`).Error
+}
+
+func RemoveAccessTokenTable(db *gorm.DB) error {
+	return db.Exec(`DROP TABLE IF EXISTS public.d_access_token CASCADE;`).Error
+}
+
+// ------------------- v2.21.0 -------------------
+func AddOIDCLoginTable(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_oidc_login (
+			state varchar(64) PRIMARY KEY,
+			nonce varchar(64) NOT NULL,
+			code_verifier varchar(128) NOT NULL,
+			redirect_uri varchar(1024) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+		CREATE INDEX idx_oidc_login_expires_at ON public.d_oidc_login USING btree (expires_at);
+	`).Error
+}
+
+func RemoveOIDCLoginTable(db *gorm.DB) error {
+	return db.Exec(`DROP TABLE IF EXISTS public.d_oidc_login CASCADE;`).Error
+}
+
+// ------------------- v2.20.0 -------------------
+func AddRefreshTokenTable(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_refresh_token (
+			id UUID PRIMARY KEY,
+			creator_id int4 NOT NULL,
+			family_id UUID NOT NULL,
+			device_id varchar(64) DEFAULT '' NOT NULL,
+			token_hash varchar(64) NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			rotated_at TIMESTAMP WITH TIME ZONE,
+			revoked_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE UNIQUE INDEX idx_refresh_token_hash ON public.d_refresh_token USING btree (token_hash);
+		CREATE INDEX idx_refresh_token_family ON public.d_refresh_token USING btree (family_id);
+		CREATE INDEX idx_refresh_token_creator ON public.d_refresh_token USING btree (creator_id);
+		CREATE INDEX idx_refresh_token_expires_at ON public.d_refresh_token USING btree (expires_at);
+	`).Error
+}
+
+func RemoveRefreshTokenTable(db *gorm.DB) error {
+	return db.Exec(`DROP TABLE IF EXISTS public.d_refresh_token CASCADE;`).Error
+}
+
+// ------------------- v2.19.0 -------------------
+func AddIdempotencyTable(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_idempotency (
+			creator_id int4 NOT NULL,
+			idem_key varchar(255) NOT NULL,
+			fingerprint varchar(64) NOT NULL,
+			status int4 DEFAULT 0 NOT NULL,
+			response bytea,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			PRIMARY KEY (creator_id, idem_key)
+		);
+		CREATE INDEX idx_idempotency_expires_at ON public.d_idempotency USING btree (expires_at);
+	`).Error
+}
+
+func RemoveIdempotencyTable(db *gorm.DB) error {
+	return db.Exec(`DROP TABLE IF EXISTS public.d_idempotency CASCADE;`).Error
+}
+
+// ------------------- v2.18.0 -------------------
+func AddSyncConflictTable(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_sync_conflict (
+			id UUID PRIMARY KEY,
+			creator_id int4 NOT NULL,
+			site smallint NOT NULL,
+			entity varchar(63) NOT NULL,
+			record_id varchar(64) NOT NULL,
+			status varchar(15) NOT NULL,
+			reason text DEFAULT '' NOT NULL,
+			fields jsonb,
+			kept varchar(15) NOT NULL,
+			client_payload jsonb NOT NULL,
+			server_payload jsonb,
+			client_updated_at BIGINT NOT NULL,
+			server_updated_at BIGINT DEFAULT 0 NOT NULL,
+			device_id varchar(64) DEFAULT '' NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			resolved_at TIMESTAMP WITH TIME ZONE,
+			resolution varchar(15) DEFAULT '' NOT NULL
+		);
+		CREATE INDEX idx_sync_conflict_open ON public.d_sync_conflict USING btree (creator_id, site) WHERE resolved_at IS NULL;
+	`).Error
+}
+
+func RemoveSyncConflictTable(db *gorm.DB) error {
+	return db.Exec(`DROP TABLE IF EXISTS public.d_sync_conflict CASCADE;`).Error
+}
+
+// ------------------- v2.17.0 -------------------
+var hlcTables = append([]string{"d_tiptap_v2", "d_statistic", "d_user_v2"}, revisionTables...)
+
+// Rows written before the clock keep hlc 0 and are ordered by their updated_at
+func AddHlcColumn(db *gorm.DB) error {
+	zero := "0"
+	for _, table := range hlcTables {
+		if err := SafeColumnAdd(db, table, "hlc", "BIGINT NOT NULL", &zero); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RemoveHlcColumn(db *gorm.DB) error {
+	for _, table := range hlcTables {
+		if err := SafeColumnDrop(db, table, "hlc"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ------------------- v2.16.0 -------------------
+// Tiptap revisions are the bases of content patches and of three-way merges,
+// so they snapshot the whole document on every update. PruneSyncRevisionTask
+// keeps them bounded to the newest sync.tiptapRevisions of each document.
+func AddTiptapRevision(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TRIGGER trg_d_tiptap_v2_revision
+		AFTER INSERT OR UPDATE ON public.d_tiptap_v2
+		FOR EACH ROW EXECUTE FUNCTION global_record_revision();
+	`).Error
+}
+
+func RemoveTiptapRevision(db *gorm.DB) error {
+	return db.Exec(`
+		DROP TRIGGER IF EXISTS trg_d_tiptap_v2_revision ON public.d_tiptap_v2;
+		DELETE FROM public.d_sync_revision WHERE tbl = 'd_tiptap_v2';
+	`).Error
+}
+
+// ------------------- v2.15.0 -------------------
+func AddSyncDeviceDetails(db *gorm.DB) error {
+	empty := "''"
+	if err := SafeColumnAdd(db, "d_sync_device", "name", "varchar(255) NOT NULL", &empty); err != nil {
+		return err
+	}
+	if err := SafeColumnAdd(db, "d_sync_device", "platform", "varchar(63) NOT NULL", &empty); err != nil {
+		return err
+	}
+	if err := SafeColumnAdd(db, "d_sync_device", "last_ip", "varchar(64) NOT NULL", &empty); err != nil {
+		return err
+	}
+	if err := SafeColumnAdd(db, "d_sync_device", "last_push_at", "TIMESTAMP WITH TIME ZONE", nil); err != nil {
+		return err
+	}
+	return SafeColumnAdd(db, "d_sync_device", "revoked_at", "TIMESTAMP WITH TIME ZONE", nil)
+}
+
+func RemoveSyncDeviceDetails(db *gorm.DB) error {
+	for _, column := range []string{"name", "platform", "last_ip", "last_push_at", "revoked_at"} {
+		if err := SafeColumnDrop(db, "d_sync_device", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ------------------- v2.14.0 -------------------
+func AddSyncDevicePurgeTables(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE TABLE public.d_sync_device (
+			creator_id int4 NOT NULL,
+			device_id varchar(64) NOT NULL,
+			site smallint NOT NULL,
+			pulled_version BIGINT DEFAULT 0 NOT NULL,
+			last_pull_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			PRIMARY KEY (creator_id, device_id, site)
+		);
+
+		CREATE TABLE public.d_sync_purge (
+			creator_id int4 NOT NULL,
+			site smallint NOT NULL,
+			purged_version BIGINT DEFAULT 0 NOT NULL,
+			PRIMARY KEY (creator_id, site)
+		);
+	`).Error
+}
+
+func RemoveSyncDevicePurgeTables(db *gorm.DB) error {
+	return db.Exec(`
+		DROP TABLE IF EXISTS public.d_sync_device CASCADE;
+		DROP TABLE IF EXISTS public.d_sync_purge CASCADE;
+	`).Error
+}
+
+// ------------------- v2.13.0 -------------------
+func AddSyncChangeNotify(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE OR REPLACE FUNCTION global_bump_server_version()
+		RETURNS TRIGGER AS $$
+		DECLARE
+			owner int4;
+			scope text := '';
+		BEGIN
+			-- All tables pull from the same global counter
+			NEW.server_version = nextval('global_sync_version_seq');
+
+			IF TG_TABLE_NAME = 'd_user_v2' THEN
+				owner := NEW.id;
+			ELSE
+				owner := NEW.creator_id;
+			END IF;
+			IF TG_TABLE_NAME = 'd_tag_v2' THEN
+				scope := NEW.t_group;
+			ELSIF TG_TABLE_NAME = 'd_tiptap_v2' THEN
+				scope := NEW.site::text;
+			END IF;
+
+			-- Delivered on commit, identical payloads of a transaction are sent once
+			PERFORM pg_notify('sync_changes', json_build_object('user', owner, 'table', TG_TABLE_NAME, 'scope', scope)::text);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+	`).Error
+}
+
+func RemoveSyncChangeNotify(db *gorm.DB) error {
+	return db.Exec(`
+		CREATE OR REPLACE FUNCTION global_bump_server_version()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			-- All tables pull from the same global counter
+			NEW.server_version = nextval('global_sync_version_seq');
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+	`).Error
+}
+
+// ------------------- v2.12.0 -------------------
+var revisionTables = []string{
+	"d_blog_v2",
+	"d_bookmark_v2",
+	"d_collection_v2",
+	"d_echo_v2",
+	"d_entry_v2",
+	"d_quick_note_v2",
+	"d_tag_v2",
+	"d_todo_v2",
+	"d_watch_v2",
+	"d_card",
+	"d_folder",
+}
+
+func AddSyncRevisionTable(db *gorm.DB) error {
+	if err := db.Exec(`
+		CREATE TABLE public.d_sync_revision (
+			tbl varchar(63) NOT NULL,
+			record_id UUID NOT NULL,
+			server_version BIGINT NOT NULL,
+			creator_id int4 NOT NULL,
+			payload jsonb NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT now() NOT NULL,
+			PRIMARY KEY (tbl, record_id, server_version)
+		);
+		CREATE INDEX idx_sync_revision_created_at ON public.d_sync_revision USING btree (created_at);
+
+		-- Snapshot every new server_version of a row, used as merge base for pushes
+		CREATE OR REPLACE FUNCTION global_record_revision()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			INSERT INTO public.d_sync_revision (tbl, record_id, server_version, creator_id, payload)
+			VALUES (TG_TABLE_NAME, NEW.id, NEW.server_version, NEW.creator_id, to_jsonb(NEW))
+			ON CONFLICT DO NOTHING;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+	`).Error; err != nil {
+		return err
+	}
+
+	for _, table := range revisionTables {
+		if err := db.Exec(fmt.Sprintf(`
+			CREATE TRIGGER trg_%[1]s_revision
+			AFTER INSERT OR UPDATE ON public.%[1]s
+			FOR EACH ROW EXECUTE FUNCTION global_record_revision();
+		`, table)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func RemoveSyncRevisionTable(db *gorm.DB) error {
+	for _, table := range revisionTables {
+		if err := db.Exec(fmt.Sprintf(`DROP TRIGGER IF EXISTS trg_%[1]s_revision ON public.%[1]s;`, table)).Error; err != nil {
+			return err
+		}
+	}
+	return db.Exec(`
+		DROP FUNCTION IF EXISTS global_record_revision;
+		DROP TABLE IF EXISTS public.d_sync_revision CASCADE;
+	`).Error
+}
+
 // ------------------- v2.11.0 -------------------
 func AddStatisticTable(db *gorm.DB) error {
 	return db.Exec(`
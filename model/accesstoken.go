@@ -0,0 +1,84 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// AccessToken is a personal access token a user minted for scripts. Only the
+// hash of the token is stored, Prefix is its first characters to tell tokens
+// apart. It is limited to Scopes, see middleware.JWT.
+type AccessToken struct {
+	Id         uuid.UUID                   `gorm:"primarykey" json:"id"`
+	CreatorId  uint                        `gorm:"column:creator_id;not null" json:"-"`
+	Name       string                      `gorm:"column:name;size:255;not null" json:"name"`
+	Prefix     string                      `gorm:"column:prefix;size:16;not null" json:"prefix"`
+	TokenHash  string                      `gorm:"column:token_hash;size:64;not null" json:"-"`
+	Scopes     datatypes.JSONSlice[string] `gorm:"column:scopes;type:jsonb;not null" json:"scopes"`
+	CreatedAt  time.Time                   `gorm:"column:created_at" json:"createdAt"`
+	ExpiresAt  NullTime                    `gorm:"column:expires_at" json:"expiresAt"`
+	LastUsedAt NullTime                    `gorm:"column:last_used_at" json:"lastUsedAt"`
+}
+
+const (
+	AccessToken_Table      = "d_access_token"
+	AccessToken_TokenHash  = "token_hash"
+	AccessToken_ExpiresAt  = "expires_at"
+	AccessToken_LastUsedAt = "last_used_at"
+)
+
+// accessTokenTouch is how often the last use of a token is recorded
+const accessTokenTouch = time.Minute
+
+func (t *AccessToken) TableName() string {
+	return AccessToken_Table
+}
+
+func (t *AccessToken) Create(db *gorm.DB) error {
+	t.Id = uuid.New()
+	t.CreatedAt = time.Now()
+	return db.Create(t).Error
+}
+
+// ListAccessTokens lists the access tokens of userId, newest first.
+func ListAccessTokens(db *gorm.DB, userId uint) ([]AccessToken, error) {
+	tokens := make([]AccessToken, 0)
+	if err := db.Where(CreatorId+" = ?", userId).
+		Order(CreatedAt + " DESC").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// DeleteAccessToken revokes the access token id of userId and tells whether
+// there was one.
+func DeleteAccessToken(db *gorm.DB, userId uint, id uuid.UUID) (bool, error) {
+	rst := db.Where(Id+" = ?", id).
+		Where(CreatorId+" = ?", userId).
+		Delete(&AccessToken{})
+	return rst.RowsAffected > 0, rst.Error
+}
+
+// FindAccessToken returns the unexpired access token with the given hash, nil
+// when there is none, and records its use.
+func FindAccessToken(db *gorm.DB, hash string) (*AccessToken, error) {
+	token := &AccessToken{}
+	rst := db.Where(AccessToken_TokenHash+" = ?", hash).Find(token)
+	if rst.Error != nil {
+		return nil, rst.Error
+	}
+	now := time.Now()
+	if rst.RowsAffected == 0 || (token.ExpiresAt.Valid && !token.ExpiresAt.Time.After(now)) {
+		return nil, nil
+	}
+	if !token.LastUsedAt.Valid || now.Sub(token.LastUsedAt.Time) > accessTokenTouch {
+		if err := db.Model(token).Update(AccessToken_LastUsedAt, now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// Audit events, see AuditEvent.Event
+const (
+	AuditLogin           = "login"
+	AuditLogout          = "logout"
+	AuditTokenRefresh    = "token_refresh"
+	AuditTokenInvalid    = "token_invalid"
+	AuditUserCreated     = "user_created"
+	AuditSecretUpdated   = "secret_updated"
+	AuditSecretDecrypt   = "secret_decrypt"
+	AuditCredentialAdded = "credential_added"
+	AuditCredentialGone  = "credential_removed"
+)
+
+// Outcomes of audit events
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent records an authentication or account event. Events are only ever
+// appended, the table refuses updates, and are purged after
+// audit.retention. CreatorId is the user acting, 0 when it is not known.
+type AuditEvent struct {
+	Id        int64     `gorm:"primarykey" json:"id"`
+	CreatorId uint      `gorm:"column:creator_id;not null" json:"-"`
+	Event     string    `gorm:"column:event;size:32;not null" json:"event"`
+	Outcome   string    `gorm:"column:outcome;size:16;not null" json:"outcome"`
+	Ip        string    `gorm:"column:ip;size:64;not null" json:"ip"`
+	UserAgent string    `gorm:"column:user_agent;size:512;not null" json:"userAgent"`
+	DeviceId  string    `gorm:"column:device_id;size:64;not null" json:"deviceId"`
+	Detail    string    `gorm:"column:detail;size:255;not null" json:"detail"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"createdAt"`
+}
+
+const (
+	AuditEvent_Table = "d_audit_event"
+	// auditPageMax caps the events returned by a single ListAuditEvents
+	auditPageMax = 100
+)
+
+func (e *AuditEvent) TableName() string {
+	return AuditEvent_Table
+}
+
+func (e *AuditEvent) Create(db *gorm.DB) error {
+	e.CreatedAt = time.Now()
+	e.UserAgent = truncate(e.UserAgent, 512)
+	e.Detail = truncate(e.Detail, 255)
+	return db.Create(e).Error
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// ListAuditEvents returns a page of the events of userId, newest first, and
+// whether older events are left. It starts after the event before when it is
+// not 0 and returns at most limit events, capped at 100.
+func ListAuditEvents(db *gorm.DB, userId uint, before int64, limit int) ([]AuditEvent, bool, error) {
+	limit = auditPageSize(limit)
+	events := make([]AuditEvent, 0, limit+1)
+	if err := auditEventsQuery(db, userId, before, limit).Find(&events).Error; err != nil {
+		return nil, false, err
+	}
+	events, more := auditPage(events, limit)
+	return events, more, nil
+}
+
+// auditPage cuts the events fetched by auditEventsQuery to the page.
+func auditPage(events []AuditEvent, limit int) ([]AuditEvent, bool) {
+	if len(events) > limit {
+		return events[:limit], true
+	}
+	return events, false
+}
+
+func auditPageSize(limit int) int {
+	if limit <= 0 || limit > auditPageMax {
+		return auditPageMax
+	}
+	return limit
+}
+
+// auditEventsQuery selects a page of limit events and the first event after it.
+func auditEventsQuery(db *gorm.DB, userId uint, before int64, limit int) *gorm.DB {
+	query := db.Where(CreatorId+" = ?", userId)
+	if before > 0 {
+		query = query.Where(Id+" < ?", before)
+	}
+	return query.Order(Id + " DESC").Limit(limit + 1)
+}
+
+// PruneAuditEvents deletes the events recorded before the given time.
+func PruneAuditEvents(db *gorm.DB, before time.Time) (int64, error) {
+	rst := db.Where(CreatedAt+" < ?", before).Delete(&AuditEvent{})
+	return rst.RowsAffected, rst.Error
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestTruncate(t *testing.T) {
+	t.Run("Short strings are kept", func(t *testing.T) {
+		assert.Equal(t, "curl/8.0", truncate("curl/8.0", 512))
+	})
+
+	t.Run("Multi-byte characters are not split", func(t *testing.T) {
+		s := strings.Repeat("a", 254) + "é"
+		cut := truncate(s, 255)
+		assert.True(t, utf8.ValidString(cut))
+		assert.Equal(t, strings.Repeat("a", 254), cut)
+	})
+}
+
+func TestListAuditEvents(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+	query := func(before int64, limit int) string {
+		return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			return auditEventsQuery(tx, 1, before, auditPageSize(limit)).Find(&[]AuditEvent{})
+		})
+	}
+
+	t.Run("Page fetches one event more than the limit", func(t *testing.T) {
+		sql := query(0, 20)
+		assert.Contains(t, sql, "ORDER BY id DESC LIMIT 21")
+		assert.NotContains(t, sql, "id <")
+	})
+
+	t.Run("Next page starts before the last event", func(t *testing.T) {
+		assert.Contains(t, query(42, 20), "id < 42")
+	})
+
+	t.Run("Limit is clamped", func(t *testing.T) {
+		assert.Contains(t, query(0, 1000), "LIMIT 101")
+		assert.Contains(t, query(0, 0), "LIMIT 101")
+		assert.Contains(t, query(0, -5), "LIMIT 101")
+	})
+
+	t.Run("Page tells whether events are left", func(t *testing.T) {
+		events := []AuditEvent{{Id: 9}, {Id: 8}, {Id: 7}}
+		page, more := auditPage(events, 2)
+		assert.True(t, more)
+		assert.Equal(t, []AuditEvent{{Id: 9}, {Id: 8}}, page)
+
+		page, more = auditPage(events[:2], 2)
+		assert.False(t, more)
+		assert.Len(t, page, 2)
+	})
+}
@@ -22,12 +22,21 @@ type BlogV2Field struct {
 
 const (
 	BlogV2_Table = "d_blog_v2"
+
+	BlogV2_Private  = "Private"
+	BlogV2_Public   = "Public"
+	BlogV2_Archived = "Archived"
 )
 
 func (b *BlogV2) TableName() string {
 	return BlogV2_Table
 }
 
+func (b *BlogV2) check(c *PushCheck) {
+	c.Enum("visibility", b.Visibility, BlogV2_Private, BlogV2_Public, BlogV2_Archived)
+	c.Ref("draft", TiptapV2_Table, b.Draft, false)
+}
+
 func (b *BlogV2) Get(db *gorm.DB, where map[string]any) error {
 	rst := db.Where(where).Find(&b)
 	if rst.Error != nil {
@@ -39,43 +48,10 @@ func (b *BlogV2) Get(db *gorm.DB, where map[string]any) error {
 	return nil
 }
 
-func ListBlogV2Since(db *gorm.DB, since int64, creatorId uint) ([]BlogV2, error) {
-	var objs []BlogV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
-func FullBlogV2(db *gorm.DB, creatorId uint) ([]BlogV2, error) {
-	var objs []BlogV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
 func (b *BlogV2) Create(db *gorm.DB) error {
 	return db.Create(b).Error
 }
 
-func (b *BlogV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).UpdateColumns(b).Error
-}
-
 func (b *BlogV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
 	return db.Model(b).Where(where).Update(IsDeleted, true).Error
 }
@@ -39,43 +39,10 @@ func (b *BookmarkV2) Get(db *gorm.DB, where map[string]any) error {
 	return nil
 }
 
-func ListBookmarkV2Since(db *gorm.DB, since int64, creatorId uint) ([]BookmarkV2, error) {
-	var objs []BookmarkV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
-func FullBookmarkV2(db *gorm.DB, creatorId uint) ([]BookmarkV2, error) {
-	var objs []BookmarkV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
 func (b *BookmarkV2) Create(db *gorm.DB) error {
 	return db.Create(b).Error
 }
 
-func (b *BookmarkV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).UpdateColumns(b).Error
-}
-
 func (b *BookmarkV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
 	return db.Model(b).Where(where).Update(IsDeleted, true).Error
 }
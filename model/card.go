@@ -41,6 +41,11 @@ func (c *Card) TableName() string {
 	return Card_Table
 }
 
+func (c *Card) check(pc *PushCheck) {
+	pc.Ref("folderId", Folder_Table, c.FolderId, false)
+	pc.Ref("draft", TiptapV2_Table, c.Draft, false)
+}
+
 func (c *Card) Get(db *gorm.DB, where map[string]any) error {
 	rst := db.Where(where).Find(&c)
 	if rst.Error != nil {
@@ -60,46 +65,10 @@ func ListCards(db *gorm.DB, where map[string]any) ([]Card, error) {
 	return cards, nil
 }
 
-func ListCardsSince(db *gorm.DB, since int64, creatorId uint) ([]Card, error) {
-	var cards []Card
-
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-
-	if err := db.Find(&cards).Error; err != nil {
-		return nil, err
-	}
-	return cards, nil
-}
-
-func FullCards(db *gorm.DB, creatorId uint) ([]Card, error) {
-	var cards []Card
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-
-	if err := db.Find(&cards).Error; err != nil {
-		return nil, err
-	}
-	return cards, nil
-}
-
 func (c *Card) Create(db *gorm.DB) error {
 	return db.Create(c).Error
 }
 
-func (c *Card) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).Omit(Card_ReviewCount).UpdateColumns(c).Error
-}
-
 func (c *Card) Delete(db *gorm.DB, where map[string]any) error {
 	return db.Where(where).Delete(c).Error
 }
@@ -34,43 +34,10 @@ func (c *CollectionV2) Get(db *gorm.DB, where map[string]any) error {
 	return nil
 }
 
-func ListCollectionV2Since(db *gorm.DB, since int64, creatorId uint) ([]CollectionV2, error) {
-	var objs []CollectionV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
-func FullCollectionV2(db *gorm.DB, creatorId uint) ([]CollectionV2, error) {
-	var objs []CollectionV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
 func (c *CollectionV2) Create(db *gorm.DB) error {
 	return db.Create(c).Error
 }
 
-func (c *CollectionV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).UpdateColumns(c).Error
-}
-
 func (c *CollectionV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
 	return db.Model(c).Where(where).Update(IsDeleted, true).Error
 }
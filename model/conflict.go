@@ -0,0 +1,228 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Sides of a conflict kept in the stored row
+const (
+	ConflictKeptClient = "client"
+	ConflictKeptServer = "server"
+	ConflictKeptMerged = "merged"
+)
+
+// Resolutions of a conflict, the manual one writes a merge edited by the user
+const (
+	ConflictPickClient = "client"
+	ConflictPickServer = "server"
+	ConflictPickManual = "manual"
+)
+
+var ErrConflictNotFound = errors.New("conflict not found or already resolved")
+
+// SyncConflict records a push that discarded a version of a record, or some of
+// its fields: a stale or rejected client copy, or a server copy overwritten by
+// last-writer-wins. ServerPayload is empty when there was no stored row.
+type SyncConflict struct {
+	Id              uuid.UUID      `gorm:"primarykey" json:"id"`
+	CreatorId       uint           `gorm:"column:creator_id;not null" json:"-"`
+	Site            int16          `gorm:"column:site;not null" json:"site"`
+	Entity          string         `gorm:"column:entity;size:63;not null" json:"entity"`
+	RecordId        string         `gorm:"column:record_id;size:64;not null" json:"recordId"`
+	Status          string         `gorm:"column:status;size:15;not null" json:"status"`
+	Reason          string         `gorm:"column:reason;type:text;not null" json:"reason"`
+	Fields          datatypes.JSON `gorm:"column:fields;type:jsonb" json:"fields"`
+	Kept            string         `gorm:"column:kept;size:15;not null" json:"kept"`
+	ClientPayload   datatypes.JSON `gorm:"column:client_payload;type:jsonb;not null" json:"clientPayload"`
+	ServerPayload   datatypes.JSON `gorm:"column:server_payload;type:jsonb" json:"serverPayload"`
+	ClientUpdatedAt int64          `gorm:"column:client_updated_at;not null" json:"clientUpdatedAt"`
+	ServerUpdatedAt int64          `gorm:"column:server_updated_at;not null" json:"serverUpdatedAt"`
+	DeviceId        string         `gorm:"column:device_id;size:64;not null" json:"deviceId"`
+	CreatedAt       time.Time      `gorm:"column:created_at" json:"createdAt"`
+	ResolvedAt      NullTime       `gorm:"column:resolved_at" json:"resolvedAt"`
+	Resolution      string         `gorm:"column:resolution;size:15;not null" json:"resolution"`
+}
+
+const (
+	SyncConflict_Table      = "d_sync_conflict"
+	SyncConflict_Site       = "site"
+	SyncConflict_ResolvedAt = "resolved_at"
+	SyncConflict_Resolution = "resolution"
+)
+
+func (c *SyncConflict) TableName() string {
+	return SyncConflict_Table
+}
+
+// logConflicts stores a SyncConflict for every result of e that lost a version.
+func logConflicts(tx *gorm.DB, site int16, e *SyncEntity, userId uint, deviceId string, results []PushResult) error {
+	conflicts := make([]SyncConflict, 0)
+	for _, r := range results {
+		if r.lost == nil {
+			continue
+		}
+		client, err := json.Marshal(r.lost.client)
+		if err != nil {
+			return err
+		}
+		var server []byte
+		if r.lost.server != nil {
+			if server, err = json.Marshal(r.lost.server); err != nil {
+				return err
+			}
+		}
+		var fields []byte
+		if len(r.Conflicts) > 0 {
+			if fields, err = json.Marshal(r.Conflicts); err != nil {
+				return err
+			}
+		}
+		conflicts = append(conflicts, SyncConflict{
+			Id:              uuid.New(),
+			CreatorId:       userId,
+			Site:            site,
+			Entity:          e.Name,
+			RecordId:        r.Id,
+			Status:          r.Status,
+			Reason:          r.Reason,
+			Fields:          fields,
+			Kept:            r.lost.kept,
+			ClientPayload:   client,
+			ServerPayload:   server,
+			ClientUpdatedAt: r.lost.clientUpdatedAt,
+			ServerUpdatedAt: r.lost.serverUpdatedAt,
+			DeviceId:        deviceId,
+		})
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(conflicts, pushBatchSize).Error
+}
+
+// ListSyncConflicts lists the open conflicts of a user on a site, newest first.
+func ListSyncConflicts(db *gorm.DB, userId uint, site int16) ([]SyncConflict, error) {
+	conflicts := make([]SyncConflict, 0)
+	if err := db.Where(CreatorId+" = ?", userId).
+		Where(SyncConflict_Site+" = ?", site).
+		Where(SyncConflict_ResolvedAt + " IS NULL").
+		Order(CreatedAt + " DESC").
+		Find(&conflicts).Error; err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// ResolveSyncConflict closes an open conflict of the site. Picking the side
+// that was not kept, or a manual merge, writes it as a new version of the
+// record through the regular push path, so every device pulls it. It returns
+// the push result of that write, nil when the kept side was picked.
+func (s *SyncSite) ResolveSyncConflict(tx *gorm.DB, userId uint, id uuid.UUID, pick string, manual json.RawMessage) (*PushResult, error) {
+	conflict := &SyncConflict{}
+	rst := tx.Where(Id+" = ?", id).
+		Where(CreatorId+" = ?", userId).
+		Where(SyncConflict_Site+" = ?", s.Id).
+		Where(SyncConflict_ResolvedAt + " IS NULL").
+		Find(conflict)
+	if rst.Error != nil {
+		return nil, rst.Error
+	}
+	if rst.RowsAffected == 0 {
+		return nil, ErrConflictNotFound
+	}
+
+	var payload json.RawMessage
+	switch pick {
+	case ConflictPickClient:
+		payload = json.RawMessage(conflict.ClientPayload)
+	case ConflictPickServer:
+		if len(conflict.ServerPayload) == 0 {
+			return nil, fmt.Errorf("conflict %s has no server version", id)
+		}
+		payload = json.RawMessage(conflict.ServerPayload)
+	case ConflictPickManual:
+		if len(manual) == 0 {
+			return nil, fmt.Errorf("a manual resolution needs the merged record")
+		}
+		payload = manual
+	default:
+		return nil, fmt.Errorf("unknown pick %s", pick)
+	}
+
+	var result *PushResult
+	if pick != conflict.Kept {
+		e := s.entity(conflict.Entity)
+		if e == nil || e.ReadOnly {
+			return nil, fmt.Errorf("entity %s can not be pushed", conflict.Entity)
+		}
+		r, err := s.rewrite(tx, e, userId, conflict.RecordId, payload)
+		if err != nil {
+			return nil, err
+		}
+		result = &r
+	}
+
+	return result, tx.Model(conflict).Updates(map[string]any{
+		SyncConflict_ResolvedAt: time.Now(),
+		SyncConflict_Resolution: pick,
+	}).Error
+}
+
+// rewrite pushes payload as the newest version of the record, edited from its
+// current server version.
+func (s *SyncSite) rewrite(tx *gorm.DB, e *SyncEntity, userId uint, recordId string, payload json.RawMessage) (PushResult, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return PushResult{}, fmt.Errorf("invalid record: %w", err)
+	}
+	if err := LockSyncWriter(tx, userId); err != nil {
+		return PushResult{}, err
+	}
+	var versions []int64
+	if err := e.scoped(tx, userId).Where(Id+" = ?", recordId).Pluck(ServerVersion, &versions).Error; err != nil {
+		return PushResult{}, err
+	}
+	var version int64
+	if len(versions) > 0 {
+		version = versions[0]
+	}
+
+	fields["serverVersion"], _ = json.Marshal(version)
+	fields["updatedAt"], _ = json.Marshal(time.Now().UnixMilli())
+	fields["hlc"], _ = json.Marshal(0)
+	if e.store.tombstones() {
+		fields["id"], _ = json.Marshal(recordId)
+	}
+	record, err := json.Marshal([]map[string]json.RawMessage{fields})
+	if err != nil {
+		return PushResult{}, err
+	}
+
+	results, err := e.Push(tx, userId, SyncSchemaMax, record)
+	if err != nil {
+		return PushResult{}, err
+	}
+	if len(results) != 1 {
+		return PushResult{}, fmt.Errorf("failed to write the resolution")
+	}
+	if r := results[0]; r.Status != PushCreated && r.Status != PushUpdated {
+		return PushResult{}, fmt.Errorf("failed to write the resolution, %s: %s", r.Status, r.Reason)
+	}
+	return results[0], nil
+}
+
+func (s *SyncSite) entity(name string) *SyncEntity {
+	for _, e := range s.Entities {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
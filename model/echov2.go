@@ -28,6 +28,11 @@ func (e *EchoV2) TableName() string {
 	return EchoV2_Table
 }
 
+func (e *EchoV2) check(c *PushCheck) {
+	c.Enum("type", e.Type, "Week", "Year", "Decade")
+	c.Ref("draft", TiptapV2_Table, e.Draft, false)
+}
+
 func (e *EchoV2) Get(db *gorm.DB, where map[string]any) error {
 	rst := db.Where(where).Find(&e)
 	if rst.Error != nil {
@@ -39,43 +44,10 @@ func (e *EchoV2) Get(db *gorm.DB, where map[string]any) error {
 	return nil
 }
 
-func ListEchoV2Since(db *gorm.DB, since int64, creatorId uint) ([]EchoV2, error) {
-	var objs []EchoV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
-func FullEchoV2(db *gorm.DB, creatorId uint) ([]EchoV2, error) {
-	var objs []EchoV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
 func (e *EchoV2) Create(db *gorm.DB) error {
 	return db.Create(e).Error
 }
 
-func (e *EchoV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).UpdateColumns(e).Error
-}
-
 func (e *EchoV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
 	return db.Model(e).Where(where).Update(IsDeleted, true).Error
 }
@@ -44,6 +44,10 @@ func (e *EntryV2) TableName() string {
 	return EntryV2_Table
 }
 
+func (e *EntryV2) check(c *PushCheck) {
+	c.Ref("draft", TiptapV2_Table, e.Draft, true)
+}
+
 func (e *EntryV2) Get(db *gorm.DB, where map[string]any) error {
 	rst := db.Where(where).Find(&e)
 	if rst.Error != nil {
@@ -55,43 +59,10 @@ func (e *EntryV2) Get(db *gorm.DB, where map[string]any) error {
 	return nil
 }
 
-func ListEntryV2Since(db *gorm.DB, since int64, creatorId uint) ([]EntryV2, error) {
-	var objs []EntryV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
-func FullEntryV2(db *gorm.DB, creatorId uint) ([]EntryV2, error) {
-	var objs []EntryV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
 func (e *EntryV2) Create(db *gorm.DB) error {
 	return db.Create(e).Error
 }
 
-func (e *EntryV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).Omit(EntryV2_ReviewCount).UpdateColumns(e).Error
-}
-
 func (e *EntryV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
 	return db.Model(e).Where(where).Update(IsDeleted, true).Error
 }
@@ -225,9 +196,15 @@ func GetRandomEntriesV2(db *gorm.DB, userId uint, randomSize int) ([]EntryMeta,
 		}
 
 		if len(entryIds) > 0 {
-			db.Model(&EntryV2{}).
-				Where("id IN ?", entryIds).
-				UpdateColumn(EntryV2_ReviewCount, gorm.Expr(EntryV2_ReviewCount+" + 1"))
+			// review counts are synced, so they are written like a push
+			db.Transaction(func(tx *gorm.DB) error {
+				if err := LockSyncWriter(tx, userId); err != nil {
+					return err
+				}
+				return tx.Model(&EntryV2{}).
+					Where("id IN ?", entryIds).
+					UpdateColumn(EntryV2_ReviewCount, gorm.Expr(EntryV2_ReviewCount+" + 1")).Error
+			})
 		}
 	}()
 
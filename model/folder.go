@@ -35,6 +35,10 @@ func (f *Folder) TableName() string {
 	return Folder_Table
 }
 
+func (f *Folder) check(c *PushCheck) {
+	c.Ref("parentId", Folder_Table, f.ParentId, false)
+}
+
 func (f *Folder) Get(db *gorm.DB, where map[string]any) error {
 	rst := db.Where(where).Find(&f)
 	if rst.Error != nil {
@@ -55,45 +59,10 @@ func ListFolders(db *gorm.DB, where map[string]any) ([]Folder, error) {
 	return folders, nil
 }
 
-func ListFoldersSince(db *gorm.DB, since int64, creatorId uint) ([]Folder, error) {
-	var folders []Folder
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.GT(ServerVersion, since)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-
-	if err := db.Find(&folders).Error; err != nil {
-		return nil, err
-	}
-	return folders, nil
-}
-
-func FullFolders(db *gorm.DB, creatorId uint) ([]Folder, error) {
-	var folders []Folder
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-
-	if err := db.Find(&folders).Error; err != nil {
-		return nil, err
-	}
-	return folders, nil
-}
-
 func (f *Folder) Create(db *gorm.DB) error {
 	return db.Create(f).Error
 }
 
-func (f *Folder) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).UpdateColumns(f).Error
-}
-
 func (f *Folder) Delete(db *gorm.DB, where map[string]any) error {
 	return db.Where(where).Delete(f).Error
 }
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// hlcLogicalBits is the width of the logical counter below the physical time
+const hlcLogicalBits = 16
+
+// HLC is a hybrid logical clock. Its timestamps hold the physical time in
+// milliseconds above a logical counter, so they compare as plain integers and
+// stay close to wall time while never going backwards.
+type HLC struct {
+	mu   sync.Mutex
+	last int64
+	now  func() time.Time
+}
+
+// Clock issues the timestamps of synced rows.
+var Clock = NewHLC(time.Now)
+
+func NewHLC(now func() time.Time) *HLC {
+	return &HLC{now: now}
+}
+
+// HLCTimestamp returns the earliest timestamp at the given millisecond.
+func HLCTimestamp(ms int64) int64 {
+	return ms << hlcLogicalBits
+}
+
+// HLCPhysical returns the millisecond of timestamp ts.
+func HLCPhysical(ts int64) int64 {
+	return ts >> hlcLogicalBits
+}
+
+// Now issues a timestamp greater than every timestamp issued or observed before.
+func (c *HLC) Now() int64 {
+	return c.Update(0)
+}
+
+// Update observes remote, a timestamp received from elsewhere, and issues a
+// timestamp greater than it.
+func (c *HLC) Update(remote int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last = max(HLCTimestamp(c.now().UnixMilli()), remote+1, c.last+1)
+	return c.last
+}
+
+// ClockPolicy decides what happens to pushed records dated in the future.
+type ClockPolicy struct {
+	// MaxSkew is how far ahead of the server a client UpdatedAt may be
+	MaxSkew time.Duration
+	// Reject refuses records beyond MaxSkew instead of clamping them to the server time
+	Reject bool
+}
+
+var clockPolicy = ClockPolicy{MaxSkew: time.Minute}
+
+// SetClockPolicy replaces the policy applied to pushed records.
+func SetClockPolicy(p ClockPolicy) {
+	clockPolicy = p
+}
+
+// checkUpdatedAt enforces the clock policy on a pushed UpdatedAt. It reports
+// false when the record must be rejected, and otherwise clamps updatedAt.
+func checkUpdatedAt(updatedAt *int64) bool {
+	now := Clock.now()
+	if *updatedAt <= now.Add(clockPolicy.MaxSkew).UnixMilli() {
+		return true
+	}
+	if clockPolicy.Reject {
+		return false
+	}
+	*updatedAt = now.UnixMilli()
+	return true
+}
+
+// clientTimestamp orders a pushed edit. It is the edit time, but never before
+// the timestamp of the copy it was made from, hlc, as a device has seen that
+// copy before editing it. A hlc beyond what the server could have issued is ignored.
+func clientTimestamp(updatedAt, hlc int64) int64 {
+	ts := HLCTimestamp(updatedAt)
+	if hlc > 0 && hlc <= HLCTimestamp(Clock.now().Add(clockPolicy.MaxSkew).UnixMilli()) {
+		ts = max(ts, hlc+1)
+	}
+	return ts
+}
+
+// rowTimestamp orders a stored row, rows written before the clock have no hlc
+// and are ordered by their updatedAt.
+func rowTimestamp(updatedAt, hlc int64) int64 {
+	return max(hlc, HLCTimestamp(updatedAt))
+}
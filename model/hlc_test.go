@@ -0,0 +1,53 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHLC(t *testing.T) {
+	wall := time.UnixMilli(1_000_000)
+	clock := NewHLC(func() time.Time { return wall })
+
+	t.Run("Timestamps increase while the wall clock stands still", func(t *testing.T) {
+		a, b := clock.Now(), clock.Now()
+		assert.Greater(t, b, a)
+		assert.Equal(t, wall.UnixMilli(), HLCPhysical(b))
+	})
+
+	t.Run("Remote timestamps ahead are overtaken", func(t *testing.T) {
+		remote := HLCTimestamp(wall.UnixMilli() + 5000)
+		assert.Greater(t, clock.Update(remote), remote)
+		assert.Greater(t, clock.Now(), remote)
+	})
+}
+
+func TestCheckUpdatedAt(t *testing.T) {
+	now := time.Now().UnixMilli()
+	defer SetClockPolicy(clockPolicy)
+
+	SetClockPolicy(ClockPolicy{MaxSkew: time.Minute})
+	past := now - 1000
+	assert.True(t, checkUpdatedAt(&past))
+	assert.Equal(t, now-1000, past)
+
+	future := now + time.Hour.Milliseconds()
+	assert.True(t, checkUpdatedAt(&future))
+	assert.LessOrEqual(t, future, time.Now().UnixMilli())
+
+	SetClockPolicy(ClockPolicy{MaxSkew: time.Minute, Reject: true})
+	future = now + time.Hour.Milliseconds()
+	assert.False(t, checkUpdatedAt(&future))
+}
+
+func TestClientTimestamp(t *testing.T) {
+	now := time.Now().UnixMilli()
+	pulled := HLCTimestamp(now)
+
+	// a device running late still orders after the copy it edited
+	assert.Greater(t, clientTimestamp(now-time.Hour.Milliseconds(), pulled), pulled)
+	// a hlc the server cannot have issued is ignored
+	assert.Equal(t, HLCTimestamp(now-1000), clientTimestamp(now-1000, HLCTimestamp(now+time.Hour.Milliseconds())))
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyRecord is a request sent with an Idempotency-Key. Status is 0
+// while the request is in flight, the response is kept once it completed.
+// RenewedAt is when the request in flight last renewed its claim.
+type IdempotencyRecord struct {
+	CreatorId   uint      `gorm:"column:creator_id;primaryKey"`
+	IdemKey     string    `gorm:"column:idem_key;primaryKey;size:255"`
+	Fingerprint string    `gorm:"column:fingerprint;size:64;not null"`
+	Status      int       `gorm:"column:status;not null"`
+	Response    []byte    `gorm:"column:response"`
+	CreatedAt   time.Time `gorm:"column:created_at"`
+	RenewedAt   time.Time `gorm:"column:renewed_at"`
+	ExpiresAt   time.Time `gorm:"column:expires_at"`
+}
+
+const (
+	IdempotencyRecord_Table       = "d_idempotency"
+	IdempotencyRecord_IdemKey     = "idem_key"
+	IdempotencyRecord_Fingerprint = "fingerprint"
+	IdempotencyRecord_Status      = "status"
+	IdempotencyRecord_Response    = "response"
+	IdempotencyRecord_RenewedAt   = "renewed_at"
+	IdempotencyRecord_ExpiresAt   = "expires_at"
+)
+
+func (r *IdempotencyRecord) TableName() string {
+	return IdempotencyRecord_Table
+}
+
+// ClaimIdempotencyKey reserves key of userId for a request with the given
+// fingerprint until ttl elapses. It reports false along with the record holding
+// the key when it is taken. Claims of requests in flight not renewed within
+// lease are abandoned, e.g. by a restart, and can be taken over. See
+// RenewIdempotencyKey.
+func ClaimIdempotencyKey(db *gorm.DB, userId uint, key, fingerprint string, lease, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	now := time.Now()
+	claimed := &IdempotencyRecord{}
+	rst := db.Raw(`
+		INSERT INTO `+IdempotencyRecord_Table+` (creator_id, idem_key, fingerprint, status, created_at, renewed_at, expires_at)
+		VALUES (?, ?, ?, 0, ?, ?, ?)
+		ON CONFLICT (creator_id, idem_key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint, status = 0, response = NULL,
+			created_at = EXCLUDED.created_at, renewed_at = EXCLUDED.renewed_at, expires_at = EXCLUDED.expires_at
+		WHERE `+IdempotencyRecord_Table+`.expires_at < ?
+			OR (`+IdempotencyRecord_Table+`.status = 0 AND `+IdempotencyRecord_Table+`.renewed_at < ?)
+		RETURNING *`,
+		userId, key, fingerprint, now, now, now.Add(ttl), now, now.Add(-lease)).Scan(claimed)
+	if rst.Error != nil {
+		return nil, false, rst.Error
+	}
+	if rst.RowsAffected > 0 {
+		return claimed, true, nil
+	}
+
+	existing, err := GetIdempotencyKey(db, userId, key)
+	return existing, false, err
+}
+
+// GetIdempotencyKey returns the record of key, nil when there is none.
+func GetIdempotencyKey(db *gorm.DB, userId uint, key string) (*IdempotencyRecord, error) {
+	record := &IdempotencyRecord{}
+	rst := db.Where(CreatorId+" = ?", userId).
+		Where(IdempotencyRecord_IdemKey+" = ?", key).
+		Find(record)
+	if rst.Error != nil {
+		return nil, rst.Error
+	}
+	if rst.RowsAffected == 0 {
+		return nil, nil
+	}
+	return record, nil
+}
+
+// RenewIdempotencyKey keeps the claim of the request in flight holding key
+// from being taken over while it runs. It reports false when the key is no
+// longer claimed.
+func RenewIdempotencyKey(db *gorm.DB, userId uint, key string) (bool, error) {
+	rst := db.Model(&IdempotencyRecord{}).
+		Where(CreatorId+" = ?", userId).
+		Where(IdempotencyRecord_IdemKey+" = ?", key).
+		Where(IdempotencyRecord_Status+" = 0").
+		Update(IdempotencyRecord_RenewedAt, time.Now())
+	return rst.RowsAffected > 0, rst.Error
+}
+
+// CompleteIdempotencyKey stores the response of the request holding key.
+func CompleteIdempotencyKey(db *gorm.DB, userId uint, key string, status int, response []byte) error {
+	return db.Model(&IdempotencyRecord{}).
+		Where(CreatorId+" = ?", userId).
+		Where(IdempotencyRecord_IdemKey+" = ?", key).
+		Updates(map[string]any{
+			IdempotencyRecord_Status:   status,
+			IdempotencyRecord_Response: response,
+		}).Error
+}
+
+// ReleaseIdempotencyKey frees key so that a retry runs the request again.
+func ReleaseIdempotencyKey(db *gorm.DB, userId uint, key string) error {
+	return db.Where(CreatorId+" = ?", userId).
+		Where(IdempotencyRecord_IdemKey+" = ?", key).
+		Delete(&IdempotencyRecord{}).Error
+}
+
+// PruneIdempotencyKeys deletes the keys expired before the given time.
+func PruneIdempotencyKeys(db *gorm.DB, before time.Time) (int64, error) {
+	rst := db.Where(IdempotencyRecord_ExpiresAt+" < ?", before).Delete(&IdempotencyRecord{})
+	return rst.RowsAffected, rst.Error
+}
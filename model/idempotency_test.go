@@ -0,0 +1,53 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRenewIdempotencyKey(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.Close()
+	require.NoError(t, db.AutoMigrate(&IdempotencyRecord{}))
+	const lease = 100 * time.Millisecond
+
+	_, claimed, err := ClaimIdempotencyKey(db, 1, "slow-key", "fp", lease, time.Hour)
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	t.Run("Renewed claim is not taken over", func(t *testing.T) {
+		for range 3 {
+			time.Sleep(lease / 2)
+			held, err := RenewIdempotencyKey(db, 1, "slow-key")
+			require.NoError(t, err)
+			require.True(t, held)
+		}
+		record, claimed, err := ClaimIdempotencyKey(db, 1, "slow-key", "fp", lease, time.Hour)
+		require.NoError(t, err)
+		assert.False(t, claimed)
+		assert.Equal(t, 0, record.Status)
+	})
+
+	t.Run("Claim not renewed within the lease is taken over", func(t *testing.T) {
+		time.Sleep(lease + lease/2)
+		_, claimed, err := ClaimIdempotencyKey(db, 1, "slow-key", "fp", lease, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, claimed)
+	})
+
+	t.Run("Completed key is not renewed", func(t *testing.T) {
+		require.NoError(t, CompleteIdempotencyKey(db, 1, "slow-key", 200, []byte(`{}`)))
+		held, err := RenewIdempotencyKey(db, 1, "slow-key")
+		require.NoError(t, err)
+		assert.False(t, held)
+	})
+}
@@ -0,0 +1,140 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrIdentityNotLinked = errors.New("an account already uses this email, sign in and link this identity to it first")
+	ErrIdentityLinked    = errors.New("this identity is linked to another account")
+)
+
+// UserIdentity links the subject of an identity provider of oidc.providers to
+// the user it signs in.
+type UserIdentity struct {
+	Provider    string    `gorm:"column:provider;primaryKey;size:64" json:"provider"`
+	Subject     string    `gorm:"column:subject;primaryKey;size:255" json:"subject"`
+	CreatorId   uint      `gorm:"column:creator_id;not null" json:"-"`
+	Email       string    `gorm:"column:email;size:100;not null" json:"email"`
+	CreatedAt   time.Time `gorm:"column:created_at" json:"createdAt"`
+	LastLoginAt time.Time `gorm:"column:last_login_at" json:"lastLoginAt"`
+}
+
+const (
+	UserIdentity_Table       = "d_user_identity"
+	UserIdentity_Provider    = "provider"
+	UserIdentity_Subject     = "subject"
+	UserIdentity_Email       = "email"
+	UserIdentity_LastLoginAt = "last_login_at"
+)
+
+func (i *UserIdentity) TableName() string {
+	return UserIdentity_Table
+}
+
+// findUserIdentity returns the identity of subject at provider, nil when it
+// is not linked.
+func findUserIdentity(db *gorm.DB, provider, subject string) (*UserIdentity, error) {
+	identity := &UserIdentity{}
+	rst := db.Where(UserIdentity_Provider+" = ?", provider).
+		Where(UserIdentity_Subject+" = ?", subject).
+		Limit(1).
+		Find(identity)
+	if rst.Error != nil || rst.RowsAffected == 0 {
+		return nil, rst.Error
+	}
+	return identity, nil
+}
+
+// LinkUserIdentity links subject at provider to userId. Linking it again to
+// the same user only records the sign in, linking it to another user fails
+// with ErrIdentityLinked.
+func LinkUserIdentity(db *gorm.DB, userId uint, provider, subject, email string) error {
+	now := time.Now()
+	identity := &UserIdentity{
+		Provider:    provider,
+		Subject:     subject,
+		CreatorId:   userId,
+		Email:       email,
+		CreatedAt:   now,
+		LastLoginAt: now,
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(identity).Error; err != nil {
+		return err
+	}
+	linked, err := findUserIdentity(db, provider, subject)
+	if err != nil {
+		return err
+	}
+	if linked == nil || linked.CreatorId != userId {
+		return ErrIdentityLinked
+	}
+	return db.Model(linked).Updates(map[string]any{
+		UserIdentity_Email:       email,
+		UserIdentity_LastLoginAt: now,
+	}).Error
+}
+
+// SignInIdentity returns the user subject at provider is linked to, and
+// whether it was registered. An identity not linked yet signs in the user with
+// its email when linkByEmail is set, and otherwise only registers a new user,
+// see SignInUser. It is then linked to that user.
+func SignInIdentity(db *gorm.DB, provider, subject, email string, linkByEmail bool, inviteHash string) (uint, bool, error) {
+	identity, err := findUserIdentity(db, provider, subject)
+	if err != nil {
+		return 0, false, err
+	}
+	if identity != nil {
+		return identity.CreatorId, false, db.Model(identity).Updates(map[string]any{
+			UserIdentity_Email:       email,
+			UserIdentity_LastLoginAt: time.Now(),
+		}).Error
+	}
+
+	if !linkByEmail {
+		var count int64
+		if err := db.Model(&User{}).Where(User_Email+" = ?", email).Count(&count).Error; err != nil {
+			return 0, false, err
+		}
+		if count > 0 {
+			return 0, false, ErrIdentityNotLinked
+		}
+	}
+	var (
+		userId  uint
+		created bool
+	)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if userId, created, err = SignInUser(tx, email, inviteHash); err != nil {
+			return err
+		}
+		return LinkUserIdentity(tx, userId, provider, subject, email)
+	})
+	return userId, created, err
+}
+
+// ListUserIdentities lists the identities linked to userId.
+func ListUserIdentities(db *gorm.DB, userId uint) ([]UserIdentity, error) {
+	identities := make([]UserIdentity, 0)
+	if err := db.Where(CreatorId+" = ?", userId).
+		Order(CreatedAt).
+		Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// UnlinkUserIdentity removes the identity subject at provider of userId and
+// tells whether there was one.
+func UnlinkUserIdentity(db *gorm.DB, userId uint, provider, subject string) (bool, error) {
+	rst := db.Where(UserIdentity_Provider+" = ?", provider).
+		Where(UserIdentity_Subject+" = ?", subject).
+		Where(CreatorId+" = ?", userId).
+		Delete(&UserIdentity{})
+	return rst.RowsAffected > 0, rst.Error
+}
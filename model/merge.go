@@ -0,0 +1,115 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// mergeSkipped are the meta fields that are never merged field by field.
+var mergeSkipped = map[string]bool{
+	"id":            true,
+	"createdAt":     true,
+	"updatedAt":     true,
+	"hlc":           true,
+	"serverVersion": true,
+	"creatorId":     true,
+}
+
+// MergeFields performs a three-way merge of client and server relative to base,
+// the version the client edited from. Disjoint field changes are combined. Fields
+// changed on both sides to different values are conflicts: they take the client
+// value when clientWins is set and the server value otherwise.
+// Meta fields come from server, except updatedAt which takes the newer side.
+func MergeFields[T any](base, server, client *T, clientWins bool) (*T, []string, error) {
+	b, err := toFieldMap(base)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := toFieldMap(server)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := toFieldMap(client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged := make(map[string]json.RawMessage, len(s))
+	conflicts := make([]string, 0)
+	for key, sv := range s {
+		merged[key] = sv
+		if mergeSkipped[key] {
+			continue
+		}
+		cv, ok := c[key]
+		if !ok {
+			continue
+		}
+		bv := b[key]
+		switch {
+		case bytes.Equal(cv, bv), bytes.Equal(cv, sv):
+			// unchanged on the client or changed the same way
+		case bytes.Equal(sv, bv):
+			merged[key] = cv
+		default:
+			conflicts = append(conflicts, key)
+			if clientWins {
+				merged[key] = cv
+			}
+		}
+	}
+	if cu, su := c["updatedAt"], s["updatedAt"]; jsonInt(cu) > jsonInt(su) {
+		merged["updatedAt"] = cu
+	}
+	sort.Strings(conflicts)
+
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := new(T)
+	if err := json.Unmarshal(raw, out); err != nil {
+		return nil, nil, err
+	}
+	return out, conflicts, nil
+}
+
+// toFieldMap flattens v into its top level json fields with every value
+// re-encoded canonically, so equal values compare equal byte for byte.
+func toFieldMap(v any) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		canonical, err := canonicalJSON(value)
+		if err != nil {
+			return nil, err
+		}
+		fields[key] = canonical
+	}
+	return fields, nil
+}
+
+func canonicalJSON(raw json.RawMessage) (json.RawMessage, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func jsonInt(raw json.RawMessage) int64 {
+	var n int64
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTodo(title string, completed bool, updatedAt int64) *TodoV2 {
+	todo := &TodoV2{}
+	todo.Title = title
+	todo.Completed = completed
+	todo.UpdatedAt = updatedAt
+	return todo
+}
+
+func TestMergeFields(t *testing.T) {
+	base := testTodo("buy milk", false, 100)
+
+	t.Run("Disjoint changes are combined", func(t *testing.T) {
+		server := testTodo("buy milk", true, 200)
+		client := testTodo("buy oat milk", false, 150)
+
+		merged, conflicts, err := MergeFields(base, server, client, false)
+		require.NoError(t, err)
+		assert.Empty(t, conflicts)
+		assert.Equal(t, "buy oat milk", merged.Title)
+		assert.True(t, merged.Completed)
+		assert.Equal(t, int64(200), merged.UpdatedAt)
+	})
+
+	t.Run("Same field conflict falls back to last writer", func(t *testing.T) {
+		server := testTodo("buy soy milk", false, 200)
+		client := testTodo("buy oat milk", true, 300)
+
+		merged, conflicts, err := MergeFields(base, server, client, true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"title"}, conflicts)
+		assert.Equal(t, "buy oat milk", merged.Title)
+		assert.True(t, merged.Completed)
+		assert.Equal(t, int64(300), merged.UpdatedAt)
+
+		merged, conflicts, err = MergeFields(base, server, client, false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"title"}, conflicts)
+		assert.Equal(t, "buy soy milk", merged.Title)
+		assert.True(t, merged.Completed)
+	})
+
+	t.Run("Identical changes are not conflicts", func(t *testing.T) {
+		server := testTodo("buy oat milk", false, 200)
+		client := testTodo("buy oat milk", false, 150)
+
+		merged, conflicts, err := MergeFields(base, server, client, false)
+		require.NoError(t, err)
+		assert.Empty(t, conflicts)
+		assert.Equal(t, "buy oat milk", merged.Title)
+	})
+}
@@ -29,8 +29,10 @@ type MetaFieldV2 struct {
 	CreatedAt     int64     `gorm:"autoUpdateTime:false" json:"createdAt"`
 	UpdatedAt     int64     `gorm:"autoUpdateTime:false" json:"updatedAt"`
 	ServerVersion int64     `json:"serverVersion"`
-	IsDeleted     *bool     `json:"isDeleted"`
-	CreatorId     uint      `gorm:"column:creator_id;not null" json:"creatorId"`
+	// Hlc is the Clock timestamp of the last write, it orders concurrent edits
+	Hlc       int64 `gorm:"column:hlc;not null;default:0" json:"hlc"`
+	IsDeleted *bool `json:"isDeleted"`
+	CreatorId uint  `gorm:"column:creator_id;not null" json:"creatorId"`
 }
 
 type NullTime struct {
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OIDCLogin is a login started at the identity provider Provider and not
+// completed yet. It is keyed by the state sent back along with the
+// authorization code. LinkUserId is the user linking the identity, 0 for a
+// sign in.
+type OIDCLogin struct {
+	State        string    `gorm:"column:state;primaryKey;size:64"`
+	Provider     string    `gorm:"column:provider;size:64;not null"`
+	LinkUserId   uint      `gorm:"column:link_user_id;not null"`
+	Nonce        string    `gorm:"column:nonce;size:64;not null"`
+	CodeVerifier string    `gorm:"column:code_verifier;size:128;not null"`
+	RedirectURI  string    `gorm:"column:redirect_uri;size:1024;not null"`
+	CreatedAt    time.Time `gorm:"column:created_at"`
+	ExpiresAt    time.Time `gorm:"column:expires_at"`
+}
+
+const (
+	OIDCLogin_Table     = "d_oidc_login"
+	OIDCLogin_State     = "state"
+	OIDCLogin_ExpiresAt = "expires_at"
+)
+
+func (l *OIDCLogin) TableName() string {
+	return OIDCLogin_Table
+}
+
+// CreateOIDCLogin stores a login that can be completed within ttl.
+func CreateOIDCLogin(db *gorm.DB, login *OIDCLogin, ttl time.Duration) error {
+	login.CreatedAt = time.Now()
+	login.ExpiresAt = login.CreatedAt.Add(ttl)
+	return db.Create(login).Error
+}
+
+// TakeOIDCLogin removes and returns the unexpired login of state, nil when
+// there is none. A login can only be completed once.
+func TakeOIDCLogin(db *gorm.DB, state string) (*OIDCLogin, error) {
+	logins := make([]OIDCLogin, 0, 1)
+	if err := db.Raw(`DELETE FROM `+OIDCLogin_Table+` WHERE `+OIDCLogin_State+` = ? RETURNING *`, state).
+		Scan(&logins).Error; err != nil {
+		return nil, err
+	}
+	if len(logins) == 0 || !logins[0].ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &logins[0], nil
+}
+
+// PruneOIDCLogins deletes the logins expired before the given time.
+func PruneOIDCLogins(db *gorm.DB, before time.Time) (int64, error) {
+	rst := db.Where(OIDCLogin_ExpiresAt+" < ?", before).Delete(&OIDCLogin{})
+	return rst.RowsAffected, rst.Error
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Passkey is a WebAuthn credential a user signs in with. UserHandle is the
+// same for every passkey of a user, Credential is the verified
+// webauthn.Credential along with its signature counter.
+type Passkey struct {
+	Id           uuid.UUID      `gorm:"primarykey" json:"id"`
+	CreatorId    uint           `gorm:"column:creator_id;not null" json:"-"`
+	UserHandle   []byte         `gorm:"column:user_handle;not null" json:"-"`
+	CredentialId []byte         `gorm:"column:credential_id;not null" json:"-"`
+	Name         string         `gorm:"column:name;size:255;not null" json:"name"`
+	Credential   datatypes.JSON `gorm:"column:credential;type:jsonb;not null" json:"-"`
+	CreatedAt    time.Time      `gorm:"column:created_at" json:"createdAt"`
+	LastUsedAt   NullTime       `gorm:"column:last_used_at" json:"lastUsedAt"`
+}
+
+const (
+	Passkey_Table        = "d_passkey"
+	Passkey_UserHandle   = "user_handle"
+	Passkey_CredentialId = "credential_id"
+	Passkey_Credential   = "credential"
+	Passkey_LastUsedAt   = "last_used_at"
+)
+
+func (p *Passkey) TableName() string {
+	return Passkey_Table
+}
+
+func (p *Passkey) Create(db *gorm.DB) error {
+	p.Id = uuid.New()
+	p.CreatedAt = time.Now()
+	return db.Create(p).Error
+}
+
+// ListPasskeys lists the passkeys of userId, oldest first.
+func ListPasskeys(db *gorm.DB, userId uint) ([]Passkey, error) {
+	passkeys := make([]Passkey, 0)
+	if err := db.Where(CreatorId+" = ?", userId).
+		Order(CreatedAt).
+		Find(&passkeys).Error; err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+// ListPasskeysByHandle lists the passkeys registered for the user handle.
+func ListPasskeysByHandle(db *gorm.DB, handle []byte) ([]Passkey, error) {
+	passkeys := make([]Passkey, 0)
+	if err := db.Where(Passkey_UserHandle+" = ?", handle).
+		Order(CreatedAt).
+		Find(&passkeys).Error; err != nil {
+		return nil, err
+	}
+	return passkeys, nil
+}
+
+// UpdatePasskeyCredential stores the credential of a passkey after it signed
+// in, as its signature counter moved.
+func UpdatePasskeyCredential(db *gorm.DB, credentialId []byte, credential datatypes.JSON) error {
+	return db.Model(&Passkey{}).
+		Where(Passkey_CredentialId+" = ?", credentialId).
+		Updates(map[string]any{
+			Passkey_Credential: credential,
+			Passkey_LastUsedAt: time.Now(),
+		}).Error
+}
+
+// DeletePasskey removes the passkey id of userId and tells whether there was one.
+func DeletePasskey(db *gorm.DB, userId uint, id uuid.UUID) (bool, error) {
+	rst := db.Where(Id+" = ?", id).
+		Where(CreatorId+" = ?", userId).
+		Delete(&Passkey{})
+	return rst.RowsAffected > 0, rst.Error
+}
+
+// PasskeyCeremony is a passkey registration or login started and not
+// completed yet. CreatorId is the user registering, 0 for a login.
+type PasskeyCeremony struct {
+	Id        string         `gorm:"column:id;primaryKey;size:64"`
+	CreatorId uint           `gorm:"column:creator_id;not null"`
+	Session   datatypes.JSON `gorm:"column:session;type:jsonb;not null"`
+	CreatedAt time.Time      `gorm:"column:created_at"`
+	ExpiresAt time.Time      `gorm:"column:expires_at"`
+}
+
+const (
+	PasskeyCeremony_Table     = "d_passkey_ceremony"
+	PasskeyCeremony_ExpiresAt = "expires_at"
+)
+
+func (p *PasskeyCeremony) TableName() string {
+	return PasskeyCeremony_Table
+}
+
+// CreatePasskeyCeremony stores a ceremony that can be completed within ttl.
+func CreatePasskeyCeremony(db *gorm.DB, ceremony *PasskeyCeremony, ttl time.Duration) error {
+	ceremony.CreatedAt = time.Now()
+	ceremony.ExpiresAt = ceremony.CreatedAt.Add(ttl)
+	return db.Create(ceremony).Error
+}
+
+// TakePasskeyCeremony removes and returns the unexpired ceremony id of userId,
+// nil when there is none. A ceremony can only be completed once.
+func TakePasskeyCeremony(db *gorm.DB, id string, userId uint) (*PasskeyCeremony, error) {
+	ceremonies := make([]PasskeyCeremony, 0, 1)
+	if err := db.Raw(`DELETE FROM `+PasskeyCeremony_Table+` WHERE `+Id+` = ? AND `+CreatorId+` = ? RETURNING *`, id, userId).
+		Scan(&ceremonies).Error; err != nil {
+		return nil, err
+	}
+	if len(ceremonies) == 0 || !ceremonies[0].ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return &ceremonies[0], nil
+}
+
+// PrunePasskeyCeremonies deletes the ceremonies expired before the given time.
+func PrunePasskeyCeremonies(db *gorm.DB, before time.Time) (int64, error) {
+	rst := db.Where(PasskeyCeremony_ExpiresAt+" < ?", before).Delete(&PasskeyCeremony{})
+	return rst.RowsAffected, rst.Error
+}
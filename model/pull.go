@@ -0,0 +1,58 @@
+package model
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SyncSource is a table taking part in a pull, along with the conditions that
+// scope it to the calling user.
+type SyncSource struct {
+	Table string
+	Where WhereMap
+}
+
+// PullBound returns the server version that closes a page of at most limit rows
+// changed after since, counted across all sources, and whether more rows follow.
+// Server versions come from one global sequence, so the page holds exactly the
+// rows with since < server_version <= bound and none is skipped by the next page.
+// A bound of 0 means the page is not capped.
+func PullBound(db *gorm.DB, sources []SyncSource, since int64, limit int) (int64, bool, error) {
+	if limit <= 0 || len(sources) == 0 {
+		return 0, false, nil
+	}
+
+	subs := make([]string, 0, len(sources))
+	args := make([]any, 0, len(sources)+1)
+	for _, source := range sources {
+		sub := db.Session(&gorm.Session{NewDB: true}).
+			Table(source.Table).
+			Select(ServerVersion).
+			Where(map[string]any(source.Where)).
+			Where(ServerVersion+" > ?", since)
+		subs = append(subs, "?")
+		args = append(args, sub)
+	}
+	args = append(args, limit-1)
+
+	var versions []int64
+	if err := db.Raw("SELECT "+ServerVersion+" FROM ("+strings.Join(subs, " UNION ALL ")+") v"+
+		" ORDER BY "+ServerVersion+" LIMIT 2 OFFSET ?", args...).
+		Scan(&versions).Error; err != nil {
+		return 0, false, err
+	}
+	if len(versions) == 0 {
+		return 0, false, nil
+	}
+	return versions[0], len(versions) > 1, nil
+}
+
+// UpTo caps db to rows at or below bound, see PullBound. The returned db can be
+// reused by the queries of every entity.
+func UpTo(db *gorm.DB, bound int64) *gorm.DB {
+	if bound == 0 {
+		return db
+	}
+	return db.Where(ServerVersion+" <= ?", bound).Session(&gorm.Session{})
+}
@@ -26,6 +26,10 @@ func (q *QuickNoteV2) TableName() string {
 	return QuickNoteV2_Table
 }
 
+func (q *QuickNoteV2) check(c *PushCheck) {
+	c.Ref("draft", TiptapV2_Table, q.Draft, false)
+}
+
 func (q *QuickNoteV2) Get(db *gorm.DB, where map[string]any) error {
 	rst := db.Where(where).Find(&q)
 	if rst.Error != nil {
@@ -37,43 +41,10 @@ func (q *QuickNoteV2) Get(db *gorm.DB, where map[string]any) error {
 	return nil
 }
 
-func ListQuickNoteV2Since(db *gorm.DB, since int64, creatorId uint) ([]QuickNoteV2, error) {
-	var objs []QuickNoteV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
-func FullQuickNoteV2(db *gorm.DB, creatorId uint) ([]QuickNoteV2, error) {
-	var objs []QuickNoteV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
 func (q *QuickNoteV2) Create(db *gorm.DB) error {
 	return db.Create(q).Error
 }
 
-func (q *QuickNoteV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).UpdateColumns(q).Error
-}
-
 func (q *QuickNoteV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
 	return db.Model(q).Where(where).Update(IsDeleted, true).Error
 }
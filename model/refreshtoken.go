@@ -0,0 +1,152 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshTokenExpired = errors.New("refresh token is expired")
+	// ErrRefreshTokenReused is returned for a token that was already rotated
+	// or revoked, its whole family is revoked since it may have leaked
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+)
+
+// RefreshToken is a single use token exchanged for a new access token and the
+// next refresh token of its family. A family is the chain of tokens of one
+// login on one device.
+type RefreshToken struct {
+	Id        uuid.UUID `gorm:"primarykey"`
+	CreatorId uint      `gorm:"column:creator_id;not null"`
+	FamilyId  uuid.UUID `gorm:"column:family_id;not null"`
+	DeviceId  string    `gorm:"column:device_id;size:64;not null"`
+	TokenHash string    `gorm:"column:token_hash;size:64;not null"`
+	CreatedAt time.Time `gorm:"column:created_at"`
+	ExpiresAt time.Time `gorm:"column:expires_at"`
+	RotatedAt NullTime  `gorm:"column:rotated_at"`
+	RevokedAt NullTime  `gorm:"column:revoked_at"`
+}
+
+const (
+	RefreshToken_Table     = "d_refresh_token"
+	RefreshToken_DeviceId  = "device_id"
+	RefreshToken_FamilyId  = "family_id"
+	RefreshToken_TokenHash = "token_hash"
+	RefreshToken_ExpiresAt = "expires_at"
+	RefreshToken_RotatedAt = "rotated_at"
+	RefreshToken_RevokedAt = "revoked_at"
+)
+
+func (t *RefreshToken) TableName() string {
+	return RefreshToken_Table
+}
+
+// CreateRefreshToken stores the hash of a refresh token of userId on deviceId
+// valid for ttl. It starts a new family when familyId is the zero id.
+func CreateRefreshToken(db *gorm.DB, userId uint, deviceId string, familyId uuid.UUID, hash string, ttl time.Duration) (*RefreshToken, error) {
+	if familyId == uuid.Nil {
+		familyId = uuid.New()
+	}
+	now := time.Now()
+	token := &RefreshToken{
+		Id:        uuid.New(),
+		CreatorId: userId,
+		FamilyId:  familyId,
+		DeviceId:  deviceId,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := db.Create(token).Error; err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken uses up the refresh token with the given hash and stores
+// newHash as the next token of its family. Using a token twice revokes its
+// family, so that a stolen token and the one it was rotated into both stop working.
+// The next token stays bound to the device of the family.
+func RotateRefreshToken(db *gorm.DB, hash, newHash string, ttl time.Duration) (*RefreshToken, error) {
+	var (
+		next  *RefreshToken
+		cause error
+	)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		current := &RefreshToken{}
+		rst := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(RefreshToken_TokenHash+" = ?", hash).
+			Find(current)
+		if rst.Error != nil {
+			return rst.Error
+		}
+		now := time.Now()
+		switch {
+		case rst.RowsAffected == 0:
+			cause = ErrRefreshTokenInvalid
+			return nil
+		case current.RotatedAt.Valid || current.RevokedAt.Valid:
+			cause = ErrRefreshTokenReused
+			_, err := revokeRefreshTokens(tx.Where(RefreshToken_FamilyId+" = ?", current.FamilyId))
+			return err
+		case !current.ExpiresAt.After(now):
+			cause = ErrRefreshTokenExpired
+			return nil
+		}
+
+		if err := tx.Model(current).Update(RefreshToken_RotatedAt, now).Error; err != nil {
+			return err
+		}
+		deviceId := current.DeviceId
+		if deviceId == "" {
+			// families started before tokens were bound to a device get one
+			deviceId = uuid.NewString()
+		}
+		var err error
+		next, err = CreateRefreshToken(tx, current.CreatorId, deviceId, current.FamilyId, newHash, ttl)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return next, cause
+}
+
+// RevokeRefreshTokenFamily revokes the family of the refresh token of userId
+// with the given hash, ending that login.
+func RevokeRefreshTokenFamily(db *gorm.DB, userId uint, hash string) (int64, error) {
+	family := db.Model(&RefreshToken{}).
+		Select(RefreshToken_FamilyId).
+		Where(CreatorId+" = ?", userId).
+		Where(RefreshToken_TokenHash+" = ?", hash)
+	return revokeRefreshTokens(db.Where(RefreshToken_FamilyId+" IN (?)", family))
+}
+
+// RevokeRefreshTokens revokes every refresh token of userId.
+func RevokeRefreshTokens(db *gorm.DB, userId uint) (int64, error) {
+	return revokeRefreshTokens(db.Where(CreatorId+" = ?", userId))
+}
+
+// RevokeDeviceRefreshTokens revokes the refresh tokens userId was issued on
+// deviceId, so that the device cannot get new access tokens.
+func RevokeDeviceRefreshTokens(db *gorm.DB, userId uint, deviceId string) (int64, error) {
+	return revokeRefreshTokens(db.Where(CreatorId+" = ?", userId).Where(RefreshToken_DeviceId+" = ?", deviceId))
+}
+
+func revokeRefreshTokens(db *gorm.DB) (int64, error) {
+	rst := db.Model(&RefreshToken{}).
+		Where(RefreshToken_RevokedAt+" IS NULL").
+		Update(RefreshToken_RevokedAt, time.Now())
+	return rst.RowsAffected, rst.Error
+}
+
+// PruneRefreshTokens deletes the refresh tokens expired before the given time.
+func PruneRefreshTokens(db *gorm.DB, before time.Time) (int64, error) {
+	rst := db.Where(RefreshToken_ExpiresAt+" < ?", before).Delete(&RefreshToken{})
+	return rst.RowsAffected, rst.Error
+}
@@ -0,0 +1,203 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// RegistrationOpen lets anyone signing in become a user
+	RegistrationOpen = "open"
+	// RegistrationAllowlist only registers the emails of the allowlist
+	RegistrationAllowlist = "allowlist"
+	// RegistrationInvite only registers users redeeming an invite code
+	RegistrationInvite = "invite"
+)
+
+var (
+	ErrNotAllowlisted  = errors.New("this email is not allowed to register, ask the administrator to add it")
+	ErrInviteRequired  = errors.New("registration requires an invite code")
+	ErrInviteInvalid   = errors.New("invite code is invalid, expired or already used")
+	ErrInviteForbidden = errors.New("only administrators can manage invites")
+)
+
+// RegistrationPolicy decides who becomes a user on their first sign in.
+// Existing users always sign in.
+type RegistrationPolicy struct {
+	// Mode is RegistrationOpen, RegistrationAllowlist or RegistrationInvite
+	Mode string
+	// Allowlist holds emails, and domains as @example.com
+	Allowlist []string
+	// Admins are the emails allowed to manage invites, they always register
+	Admins []string
+}
+
+var registrationPolicy = RegistrationPolicy{Mode: RegistrationOpen}
+
+// SetRegistrationPolicy replaces the policy applied to new users.
+func SetRegistrationPolicy(p RegistrationPolicy) {
+	registrationPolicy = p
+}
+
+// IsAdmin tells whether email is an administrator.
+func (p RegistrationPolicy) IsAdmin(email string) bool {
+	return slices.ContainsFunc(p.Admins, func(admin string) bool {
+		return strings.EqualFold(admin, email)
+	})
+}
+
+// allowlisted tells whether email or its domain is in the allowlist.
+func (p RegistrationPolicy) allowlisted(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at:]
+	return slices.ContainsFunc(p.Allowlist, func(entry string) bool {
+		return strings.EqualFold(entry, email) || strings.EqualFold(entry, domain)
+	})
+}
+
+// IsAdmin tells whether the user userId is an administrator.
+func IsAdmin(db *gorm.DB, userId uint) (bool, error) {
+	emails := make([]string, 0)
+	if err := db.Model(&User{}).Where(Id+" = ?", userId).Pluck(User_Email, &emails).Error; err != nil {
+		return false, err
+	}
+	return len(emails) > 0 && registrationPolicy.IsAdmin(emails[0]), nil
+}
+
+// SignInUser returns the id of the user with email, registering a new user
+// when the registration policy allows it, and whether it was registered.
+// inviteHash is the hash of the invite code sent along, it is only redeemed
+// by a registration.
+func SignInUser(db *gorm.DB, email, inviteHash string) (uint, bool, error) {
+	user := User{}
+	rst := db.Where(User_Email+" = ?", email).Limit(1).Find(&user)
+	if rst.Error != nil {
+		return 0, false, errors.New("failed to get user: " + rst.Error.Error())
+	}
+	if rst.RowsAffected > 0 {
+		return user.ID, false, nil
+	}
+
+	policy := registrationPolicy
+	if policy.IsAdmin(email) {
+		return createUser(db, email)
+	}
+	switch policy.Mode {
+	case RegistrationAllowlist:
+		if !policy.allowlisted(email) {
+			return 0, false, ErrNotAllowlisted
+		}
+	case RegistrationInvite:
+		if inviteHash == "" {
+			return 0, false, ErrInviteRequired
+		}
+		var (
+			id      uint
+			created bool
+		)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if id, created, err = createUser(tx, email); err != nil {
+				return err
+			}
+			return redeemInvite(tx, inviteHash, id)
+		})
+		return id, created, err
+	case RegistrationOpen, "":
+	default:
+		return 0, false, fmt.Errorf("unknown registration policy %q", policy.Mode)
+	}
+	return createUser(db, email)
+}
+
+func createUser(db *gorm.DB, email string) (uint, bool, error) {
+	user := User{}
+	rst := db.Where(User_Email+" = ?", email).FirstOrCreate(&user, User{Email: email})
+	if rst.Error != nil {
+		return 0, false, errors.New("failed to create user: " + rst.Error.Error())
+	}
+	return user.ID, rst.RowsAffected > 0, nil
+}
+
+// Invite is a single use code letting one person register while registration
+// is RegistrationInvite. Only the hash of the code is stored.
+type Invite struct {
+	Id        uuid.UUID `gorm:"primarykey" json:"id"`
+	CreatorId uint      `gorm:"column:creator_id;not null" json:"-"`
+	Prefix    string    `gorm:"column:prefix;size:16;not null" json:"prefix"`
+	CodeHash  string    `gorm:"column:code_hash;size:64;not null" json:"-"`
+	CreatedAt time.Time `gorm:"column:created_at" json:"createdAt"`
+	ExpiresAt NullTime  `gorm:"column:expires_at" json:"expiresAt"`
+	UsedAt    NullTime  `gorm:"column:used_at" json:"usedAt"`
+	UsedBy    uint      `gorm:"column:used_by;not null;default:0" json:"usedBy"`
+}
+
+const (
+	Invite_Table     = "d_invite"
+	Invite_CodeHash  = "code_hash"
+	Invite_ExpiresAt = "expires_at"
+	Invite_UsedAt    = "used_at"
+	Invite_UsedBy    = "used_by"
+)
+
+func (i *Invite) TableName() string {
+	return Invite_Table
+}
+
+func (i *Invite) Create(db *gorm.DB) error {
+	i.Id = uuid.New()
+	i.CreatedAt = time.Now()
+	return db.Create(i).Error
+}
+
+// ListInvites lists the invites created by userId, newest first.
+func ListInvites(db *gorm.DB, userId uint) ([]Invite, error) {
+	invites := make([]Invite, 0)
+	if err := db.Where(CreatorId+" = ?", userId).
+		Order(CreatedAt + " DESC").
+		Find(&invites).Error; err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// DeleteInvite revokes the unused invite id of userId and tells whether there
+// was one.
+func DeleteInvite(db *gorm.DB, userId uint, id uuid.UUID) (bool, error) {
+	rst := db.Where(Id+" = ?", id).
+		Where(CreatorId+" = ?", userId).
+		Where(Invite_UsedAt + " IS NULL").
+		Delete(&Invite{})
+	return rst.RowsAffected > 0, rst.Error
+}
+
+// redeemInvite uses up the invite with the given hash for userId. The row is
+// locked so that an invite registers a single user.
+func redeemInvite(db *gorm.DB, hash string, userId uint) error {
+	invite := &Invite{}
+	rst := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(Invite_CodeHash+" = ?", hash).
+		Find(invite)
+	if rst.Error != nil {
+		return rst.Error
+	}
+	now := time.Now()
+	if rst.RowsAffected == 0 || invite.UsedAt.Valid ||
+		(invite.ExpiresAt.Valid && !invite.ExpiresAt.Time.After(now)) {
+		return ErrInviteInvalid
+	}
+	return db.Model(invite).Updates(map[string]any{
+		Invite_UsedAt: now,
+		Invite_UsedBy: userId,
+	}).Error
+}
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrationPolicy(t *testing.T) {
+	policy := RegistrationPolicy{
+		Mode:      RegistrationAllowlist,
+		Allowlist: []string{"alice@example.com", "@onlyquant.top"},
+		Admins:    []string{"Root@Example.com"},
+	}
+
+	t.Run("Allowlisted emails and domains", func(t *testing.T) {
+		assert.True(t, policy.allowlisted("alice@example.com"))
+		assert.True(t, policy.allowlisted("ALICE@example.com"))
+		assert.True(t, policy.allowlisted("bob@onlyquant.top"))
+		assert.False(t, policy.allowlisted("bob@example.com"))
+		assert.False(t, policy.allowlisted("bob@sub.onlyquant.top"))
+		assert.False(t, policy.allowlisted("onlyquant.top"))
+	})
+
+	t.Run("Admins", func(t *testing.T) {
+		assert.True(t, policy.IsAdmin("root@example.com"))
+		assert.False(t, policy.IsAdmin("alice@example.com"))
+	})
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// SyncRevision is a snapshot of a synced row, written by the
+// global_record_revision() trigger every time the row gets a new server_version.
+type SyncRevision struct {
+	Tbl           string         `gorm:"column:tbl;primaryKey"`
+	RecordId      uuid.UUID      `gorm:"column:record_id;primaryKey"`
+	ServerVersion int64          `gorm:"column:server_version;primaryKey"`
+	CreatorId     uint           `gorm:"column:creator_id"`
+	Payload       datatypes.JSON `gorm:"type:jsonb"`
+	CreatedAt     time.Time
+}
+
+const (
+	SyncRevision_Table         = "d_sync_revision"
+	SyncRevision_Tbl           = "tbl"
+	SyncRevision_RecordId      = "record_id"
+	SyncRevision_ServerVersion = "server_version"
+	SyncRevision_CreatedAt     = "created_at"
+)
+
+func (r *SyncRevision) TableName() string {
+	return SyncRevision_Table
+}
+
+// GetRevision loads the row id of table as it was at serverVersion into dest.
+// It reports false when the revision is unknown, e.g. it has been pruned.
+func GetRevision(db *gorm.DB, table string, id uuid.UUID, serverVersion int64, dest any) (bool, error) {
+	rst := db.Raw("SELECT (jsonb_populate_record(NULL::"+table+", payload)).* FROM "+SyncRevision_Table+
+		" WHERE "+SyncRevision_Tbl+" = ? AND "+SyncRevision_RecordId+" = ? AND "+SyncRevision_ServerVersion+" = ?",
+		table, id, serverVersion).Scan(dest)
+	if rst.Error != nil {
+		return false, rst.Error
+	}
+	return rst.RowsAffected > 0, nil
+}
+
+// PruneTiptapRevisions deletes the revisions of every tiptap document but the
+// newest keep. Each one holds the whole document, so frequently saved
+// documents would otherwise pile up copies until they age out.
+func PruneTiptapRevisions(db *gorm.DB, keep int) (int64, error) {
+	rst := db.Exec("DELETE FROM "+SyncRevision_Table+" r USING ("+
+		"SELECT "+SyncRevision_RecordId+", "+SyncRevision_ServerVersion+", ROW_NUMBER() OVER ("+
+		"PARTITION BY "+SyncRevision_RecordId+" ORDER BY "+SyncRevision_ServerVersion+" DESC) AS n"+
+		" FROM "+SyncRevision_Table+" WHERE "+SyncRevision_Tbl+" = ?) old"+
+		" WHERE r."+SyncRevision_Tbl+" = ? AND r."+SyncRevision_RecordId+" = old."+SyncRevision_RecordId+
+		" AND r."+SyncRevision_ServerVersion+" = old."+SyncRevision_ServerVersion+" AND old.n > ?",
+		TiptapV2_Table, TiptapV2_Table, keep)
+	return rst.RowsAffected, rst.Error
+}
+
+// PruneSyncRevisions deletes revisions recorded before the given time.
+func PruneSyncRevisions(db *gorm.DB, before time.Time) (int64, error) {
+	rst := db.Where(SyncRevision_CreatedAt+" < ?", before).Delete(&SyncRevision{})
+	return rst.RowsAffected, rst.Error
+}
@@ -46,34 +46,6 @@ func (s *StatisticV2) Get(db *gorm.DB, where map[string]any) error {
 	return nil
 }
 
-func ListStatisticV2Since(db *gorm.DB, since int64, creatorId uint) ([]StatisticV2, error) {
-	var objs []StatisticV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
-func FullStatisticV2(db *gorm.DB, creatorId uint) ([]StatisticV2, error) {
-	var objs []StatisticV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
 func (s *StatisticV2) Create(db *gorm.DB) error {
 	return db.Create(s).Error
 }
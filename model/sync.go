@@ -0,0 +1,416 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const pushBatchSize = 200
+
+const (
+	PushCreated = "created"
+	PushUpdated = "updated"
+	PushMerged  = "merged"
+	PushStale   = "stale"
+	PushFailed  = "failed"
+	// PushRejected records are refused without failing the push
+	PushRejected = "rejected"
+	// PushResend asks the client to push the whole record, its patch could not be applied
+	PushResend = "resend"
+)
+
+// PushResult is the outcome of a single pushed record.
+// Server carries the stored server copy when the pushed record is stale or has
+// been merged, Conflicts lists the fields both sides changed in a merge.
+// ServerVersion is the version of the row written for the record, if any.
+type PushResult struct {
+	Id            string   `json:"id"`
+	Status        string   `json:"status"`
+	Reason        string   `json:"reason,omitempty"`
+	Conflicts     []string `json:"conflicts,omitempty"`
+	Server        any      `json:"server,omitempty"`
+	ServerVersion int64    `json:"serverVersion,omitempty"`
+
+	// lost is the version the push discarded, logged as a SyncConflict
+	lost *lostVersion
+}
+
+// lostVersion holds both sides of a record when one of them, or some of their
+// fields, did not make it into the stored row.
+type lostVersion struct {
+	kept            string
+	client          any
+	server          any
+	clientUpdatedAt int64
+	serverUpdatedAt int64
+}
+
+// PushResults groups push outcomes by entity, keyed the same way as the push payload.
+type PushResults map[string][]PushResult
+
+// Meta exposes the local-first meta fields of a v2 model.
+func (m *MetaFieldV2) Meta() *MetaFieldV2 {
+	return m
+}
+
+type pushRecord interface {
+	Meta() *MetaFieldV2
+}
+
+// patchRecord is implemented by records that may be pushed as a patch against
+// the server copy at their serverVersion, like TiptapV2.
+type patchRecord[T any] interface {
+	patched() bool
+	applyPatch(server *T) error
+}
+
+// pushRecords applies client records of a single v2 entity using last-writer-wins
+// and reports the outcome of every record id. Records that fail validation, see
+// checkRecords, are rejected and left out.
+// It is meant to run inside the push transaction: existing rows are looked up in
+// one query and the records to write are upserted in batches, see upsertRecords.
+// When an error is returned the offending records are marked as failed and the
+// transaction must be rolled back.
+func pushRecords[T any, P interface {
+	*T
+	pushRecord
+}](tx *gorm.DB, e *SyncEntity, creatorId uint, records []T, unknown []string) ([]PushResult, error) {
+	results := make([]PushResult, 0, len(records))
+	if len(records) == 0 {
+		return results, nil
+	}
+
+	// keep only the newest copy when a record is pushed more than once
+	latest := make(map[string]int, len(records))
+	ids := make([]string, 0, len(records))
+	for i := range records {
+		meta := P(&records[i]).Meta()
+		meta.CreatorId = creatorId
+		id := meta.Id.String()
+		j, ok := latest[id]
+		if !ok {
+			ids = append(ids, id)
+		} else if P(&records[j]).Meta().UpdatedAt >= meta.UpdatedAt {
+			continue
+		}
+		latest[id] = i
+	}
+
+	foreign, err := foreignIds(tx, e.Table, creatorId, ids)
+	if err != nil {
+		return nil, err
+	}
+	pushed := make(map[string]P, len(ids))
+	for _, id := range ids {
+		pushed[id] = P(&records[latest[id]])
+	}
+	invalid, err := checkRecords[T, P](tx, e, creatorId, pushed)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []T
+	if err := tx.Table(e.Table).
+		Where(CreatorId+" = ?", creatorId).
+		Where(Id+" IN ?", ids).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*T, len(rows))
+	for i := range rows {
+		existing[P(&rows[i]).Meta().Id.String()] = &rows[i]
+	}
+
+	writes := make([]T, 0, len(ids))
+	// written holds the index in results of every row of writes
+	written := make([]int, 0, len(ids))
+	// sent keeps the records as pushed, before merging rewrites them in place
+	sent := make(map[string]*T, len(ids))
+	for _, id := range ids {
+		record := pushed[id]
+		server, ok := existing[id]
+		if foreign[id] {
+			results = append(results, PushResult{Id: id, Status: PushRejected, Reason: "id belongs to another user",
+				lost: rejected(record, nil)})
+			continue
+		}
+		if reason, bad := invalid[id]; bad {
+			results = append(results, PushResult{Id: id, Status: PushRejected, Reason: reason,
+				lost: rejected(record, server)})
+			continue
+		}
+		if p, isPatch := any(record).(patchRecord[T]); isPatch && p.patched() {
+			// a patch only applies to the version it was made from
+			if !ok || record.Meta().ServerVersion != P(server).Meta().ServerVersion {
+				results = append(results, PushResult{Id: id, Status: PushResend, Reason: "patch base is stale"})
+				continue
+			}
+			if err := p.applyPatch(server); err != nil {
+				results = append(results, PushResult{Id: id, Status: PushResend, Reason: err.Error()})
+				continue
+			}
+		}
+		meta := record.Meta()
+		if !checkUpdatedAt(&meta.UpdatedAt) {
+			results = append(results, PushResult{Id: id, Status: PushRejected, Reason: "updatedAt is too far in the future",
+				lost: rejected(record, server)})
+			continue
+		}
+		client := *(*T)(record)
+		sent[id] = &client
+		ts := clientTimestamp(meta.UpdatedAt, meta.Hlc)
+		if !ok {
+			meta.Hlc = Clock.Update(ts)
+			writes = append(writes, *(*T)(record))
+			written = append(written, len(results))
+			results = append(results, PushResult{Id: id, Status: PushCreated})
+			continue
+		}
+		// columns the client does not know about are not part of its edit
+		if err := keepColumns(server, (*T)(record), unknown); err != nil {
+			results = append(results, PushResult{Id: id, Status: PushFailed, Reason: err.Error()})
+			return results, err
+		}
+		result, err := mergeRecord(tx, e.Table, server, record, ts)
+		if err != nil {
+			results = append(results, PushResult{Id: id, Status: PushFailed, Reason: err.Error()})
+			return results, err
+		}
+		result.Id = id
+		if result.Status == PushStale {
+			results = append(results, result)
+			continue
+		}
+		serverMeta := P(server).Meta()
+		record.Meta().Hlc = Clock.Update(max(ts, rowTimestamp(serverMeta.UpdatedAt, serverMeta.Hlc)))
+		writes = append(writes, *(*T)(record))
+		written = append(written, len(results))
+		results = append(results, result)
+	}
+	if len(writes) == 0 {
+		return results, nil
+	}
+
+	stored, err := upsertRecords(tx, e, writes, unknown)
+	if err != nil {
+		for _, i := range written {
+			results[i].Status = PushFailed
+			results[i].Reason = err.Error()
+		}
+		return results, err
+	}
+	for _, i := range written {
+		r := &results[i]
+		row, ok := stored[r.Id]
+		server := existing[r.Id]
+		switch {
+		case ok:
+			r.ServerVersion = row.ServerVersion
+			if row.Inserted {
+				r.Status = PushCreated
+			} else if r.Status == PushCreated {
+				r.Status = PushUpdated
+			}
+		case server == nil:
+			// the id was taken by another user since it was checked
+			*r = PushResult{Id: r.Id, Status: PushRejected, Reason: "id belongs to another user",
+				lost: rejected(P(sent[r.Id]), nil)}
+		default:
+			// the row was written by someone else since it was read
+			*r = PushResult{Id: r.Id, Status: PushStale, Server: server, lost: rejected(P(sent[r.Id]), server)}
+		}
+	}
+	return results, nil
+}
+
+// upserted is a row written by upsertRecords
+type upserted struct {
+	Id            string `gorm:"column:id"`
+	ServerVersion int64  `gorm:"column:server_version"`
+	Inserted      bool   `gorm:"column:inserted"`
+}
+
+// upsertKept are the columns of an existing row never overwritten by a push
+var upsertKept = []string{Id, CreatedAt, ServerVersion, CreatorId}
+
+// upsertRecords writes rows in batches of INSERT ... ON CONFLICT (id) DO UPDATE
+// and returns the rows actually written keyed by id. An existing row is only
+// overwritten when it belongs to the same user and carries an older clock than
+// the pushed one, so last-writer-wins and ownership hold even against a writer
+// that changed the row since it was read. Meta, server-only and unknown columns
+// of existing rows are kept.
+func upsertRecords[T any](tx *gorm.DB, e *SyncEntity, rows []T, unknown []string) (map[string]upserted, error) {
+	written := make(map[string]upserted, len(rows))
+	for start := 0; start < len(rows); start += pushBatchSize {
+		batch := rows[start:min(start+pushBatchSize, len(rows))]
+		stmt, err := upsertStatement(tx, e, batch, unknown)
+		if err != nil {
+			return nil, err
+		}
+		var returned []upserted
+		if err := tx.Raw(stmt.SQL.String(), stmt.Vars...).Scan(&returned).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range returned {
+			written[r.Id] = r
+		}
+	}
+	return written, nil
+}
+
+// upsertStatement builds the upsert of batch without running it. Run by Create,
+// gorm would scan the returned rows into batch by position, while the rows
+// skipped by the conflict condition return nothing.
+func upsertStatement[T any](tx *gorm.DB, e *SyncEntity, batch []T, unknown []string) (*gorm.Statement, error) {
+	s, err := schema.Parse(new(T), &recordSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+	omit := append(append([]string{}, e.ServerOnly...), unknown...)
+	updates := make([]string, 0, len(s.DBNames))
+	for _, column := range s.DBNames {
+		if !slices.Contains(omit, column) && !slices.Contains(upsertKept, column) {
+			updates = append(updates, column)
+		}
+	}
+	onConflict := clause.OnConflict{
+		Columns:   []clause.Column{{Name: Id}},
+		DoUpdates: clause.AssignmentColumns(updates),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: fmt.Sprintf(
+			"GREATEST(%[1]s.hlc, %[1]s.updated_at << %[2]d) < EXCLUDED.hlc AND %[1]s.creator_id = EXCLUDED.creator_id",
+			e.Table, hlcLogicalBits)}}},
+	}
+	returning := clause.Returning{Columns: []clause.Column{
+		{Name: Id},
+		{Name: ServerVersion},
+		{Name: "(xmax = 0) AS inserted", Raw: true},
+	}}
+
+	dry := tx.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true}).Table(e.Table).Omit(omit...).
+		Clauses(onConflict, returning).Create(&batch)
+	return dry.Statement, dry.Error
+}
+
+// mergeRecord decides how the pushed record replaces server. A record edited from
+// the current server version is applied as is. When the server moved on since the
+// client's base version (its serverVersion), field changes are merged three-way and
+// only fields changed on both sides fall back to last-writer-wins. Without a known
+// base the whole record is resolved by last-writer-wins. The last writer is
+// decided by ts, the clientTimestamp of the record, against the server row.
+// The record is updated in place to the row that has to be written.
+func mergeRecord[T any, P interface {
+	*T
+	pushRecord
+}](tx *gorm.DB, table string, server *T, record P, ts int64) (PushResult, error) {
+	serverMeta, clientMeta := P(server).Meta(), record.Meta()
+	base := clientMeta.ServerVersion
+	if base != 0 && base == serverMeta.ServerVersion {
+		return PushResult{Status: PushUpdated}, nil
+	}
+	client := *(*T)(record)
+	lost := &lostVersion{
+		client:          &client,
+		server:          server,
+		clientUpdatedAt: clientMeta.UpdatedAt,
+		serverUpdatedAt: serverMeta.UpdatedAt,
+	}
+
+	clientWins := ts > rowTimestamp(serverMeta.UpdatedAt, serverMeta.Hlc)
+	baseRow := new(T)
+	found := false
+	if base != 0 && base < serverMeta.ServerVersion {
+		var err error
+		if found, err = GetRevision(tx, table, clientMeta.Id, base, baseRow); err != nil {
+			return PushResult{}, err
+		}
+	}
+	if !found {
+		if !clientWins {
+			lost.kept = ConflictKeptServer
+			return PushResult{Status: PushStale, Server: server, lost: lost}, nil
+		}
+		lost.kept = ConflictKeptClient
+		return PushResult{Status: PushUpdated, lost: lost}, nil
+	}
+
+	merged, conflicts, err := MergeFields(baseRow, server, (*T)(record), clientWins)
+	if err != nil {
+		return PushResult{}, err
+	}
+	*record = *merged
+	result := PushResult{Status: PushMerged, Conflicts: conflicts, Server: merged}
+	if len(conflicts) > 0 {
+		lost.kept = ConflictKeptMerged
+		result.lost = lost
+	}
+	return result, nil
+}
+
+// pushUsers applies the pushed user profile of userId using last-writer-wins.
+func pushUsers(tx *gorm.DB, e *SyncEntity, userId uint, views []UserV2View, unknown []string) ([]PushResult, error) {
+	results := make([]PushResult, 0, len(views))
+	id := strconv.FormatUint(uint64(userId), 10)
+	for i := range views {
+		existing := &UserV2{}
+		where := WhereMap{}
+		where.Eq(Id, userId)
+		if err := existing.Get(tx, where); err != nil {
+			results = append(results, PushResult{Id: id, Status: PushFailed, Reason: err.Error()})
+			return results, err
+		}
+
+		if !checkUpdatedAt(&views[i].UpdatedAt) {
+			results = append(results, PushResult{Id: id, Status: PushRejected, Reason: "updatedAt is too far in the future"})
+			continue
+		}
+		ts := clientTimestamp(views[i].UpdatedAt, views[i].Hlc)
+		serverTs := rowTimestamp(existing.UpdatedAt, existing.Hlc)
+		lost := &lostVersion{
+			kept:            ConflictKeptServer,
+			client:          views[i],
+			server:          existing.UserV2View,
+			clientUpdatedAt: views[i].UpdatedAt,
+			serverUpdatedAt: existing.UpdatedAt,
+		}
+		if ts <= serverTs {
+			results = append(results, PushResult{Id: id, Status: PushStale, Server: existing.UserV2View, lost: lost})
+			continue
+		}
+
+		views[i].Hlc = Clock.Update(max(ts, serverTs))
+		if err := e.write(tx, where, &views[i], unknown); err != nil {
+			results = append(results, PushResult{Id: id, Status: PushFailed, Reason: err.Error()})
+			return results, err
+		}
+		result := PushResult{Id: id, Status: PushUpdated}
+		if views[i].ServerVersion != existing.ServerVersion {
+			// the profile was edited from an older version and replaces the newer one
+			lost.kept = ConflictKeptClient
+			result.lost = lost
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// rejected keeps a rejected record along with the stored row, when there is one.
+func rejected[T any, P interface {
+	*T
+	pushRecord
+}](record P, server *T) *lostVersion {
+	lost := &lostVersion{
+		kept:            ConflictKeptServer,
+		client:          record,
+		clientUpdatedAt: record.Meta().UpdatedAt,
+	}
+	if server != nil {
+		lost.server = server
+		lost.serverUpdatedAt = P(server).Meta().UpdatedAt
+	}
+	return lost
+}
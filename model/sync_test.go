@@ -0,0 +1,73 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestUpsertStatement(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	e := &SyncEntity{Name: "entries", Table: EntryV2_Table, ServerOnly: []string{EntryV2_ReviewCount},
+		Added: map[string]int{"word_count": 2}}
+	rows := []EntryV2{{MetaFieldV2: MetaFieldV2{Id: uuid.New(), CreatorId: 1}}, {MetaFieldV2: MetaFieldV2{Id: uuid.New(), CreatorId: 1}}}
+	stmt, err := upsertStatement(db, e, rows, e.unknownColumns(1))
+	require.NoError(t, err)
+	sql := stmt.SQL.String()
+
+	assert.Contains(t, sql, `ON CONFLICT ("id") DO UPDATE SET`)
+	assert.Contains(t, sql, `"raw_text"="excluded"."raw_text"`)
+	// server-only and unknown columns are neither inserted nor updated
+	assert.NotContains(t, sql, "review_count")
+	assert.NotContains(t, sql, "word_count")
+	// meta columns are inserted but never overwritten
+	assert.NotContains(t, sql, `"creator_id"="excluded"."creator_id"`)
+	assert.NotContains(t, sql, `"created_at"="excluded"."created_at"`)
+	assert.Contains(t, sql, "WHERE GREATEST(d_entry_v2.hlc, d_entry_v2.updated_at << 16) < EXCLUDED.hlc AND d_entry_v2.creator_id = EXCLUDED.creator_id")
+	assert.Contains(t, sql, `RETURNING "id","server_version",(xmax = 0) AS inserted`)
+}
+
+func TestSchemaGatedPush(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	// completed stands for a column introduced by schema 2
+	e := &SyncEntity{Name: "todos", Table: TodoV2_Table, Added: map[string]int{"completed": 2}}
+	server := testTodo("buy milk", true, 200)
+	server.Id = uuid.New()
+
+	t.Run("A schema 1 push keeps the schema 2 columns of the row", func(t *testing.T) {
+		record := *testTodo("buy oat milk", false, 300)
+		record.Id = server.Id
+		unknown := e.unknownColumns(1)
+		require.NoError(t, keepColumns(server, &record, unknown))
+		assert.Equal(t, "buy oat milk", record.Title)
+		assert.True(t, record.Completed)
+
+		stmt, err := upsertStatement(db, e, []TodoV2{record}, unknown)
+		require.NoError(t, err)
+		sql := stmt.SQL.String()
+		assert.Contains(t, sql, `"title"="excluded"."title"`)
+		assert.NotContains(t, sql, "completed")
+	})
+
+	t.Run("A schema 2 push writes them", func(t *testing.T) {
+		record := *testTodo("buy oat milk", false, 300)
+		record.Id = server.Id
+		unknown := e.unknownColumns(2)
+		require.NoError(t, keepColumns(server, &record, unknown))
+		assert.False(t, record.Completed)
+
+		stmt, err := upsertStatement(db, e, []TodoV2{record}, unknown)
+		require.NoError(t, err)
+		assert.Contains(t, stmt.SQL.String(), `"completed"="excluded"."completed"`)
+	})
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrDeviceRevoked is returned for sync calls of a revoked device.
+var ErrDeviceRevoked = errors.New("device has been revoked")
+
+// SyncDevice is a client install syncing a site. PulledVersion is the highest
+// server version the device has acknowledged, i.e. the since of its last pull.
+// Devices which only pushed have no LastPullAt and acknowledged nothing.
+type SyncDevice struct {
+	CreatorId     uint     `gorm:"column:creator_id;primaryKey" json:"-"`
+	DeviceId      string   `gorm:"column:device_id;primaryKey;size:64" json:"deviceId"`
+	Site          int16    `gorm:"column:site;primaryKey" json:"site"`
+	Name          string   `gorm:"column:name;size:255" json:"name"`
+	Platform      string   `gorm:"column:platform;size:63" json:"platform"`
+	PulledVersion int64    `gorm:"column:pulled_version" json:"pulledVersion"`
+	LastPullAt    NullTime `gorm:"column:last_pull_at" json:"lastPullAt"`
+	LastPushAt    NullTime `gorm:"column:last_push_at" json:"lastPushAt"`
+	LastIp        string   `gorm:"column:last_ip;size:64" json:"lastIp"`
+	RevokedAt     NullTime `gorm:"column:revoked_at" json:"revokedAt"`
+}
+
+// DeviceInfo describes the client install behind a request, as sent by the client.
+type DeviceInfo struct {
+	Id       string
+	Name     string
+	Platform string
+	Ip       string
+	// Schema is the sync schema the client speaks, SyncSchemaMalformed when it
+	// sent something else than a number
+	Schema int
+}
+
+const (
+	SyncDevice_Table         = "d_sync_device"
+	SyncDevice_DeviceId      = "device_id"
+	SyncDevice_Site          = "site"
+	SyncDevice_Name          = "name"
+	SyncDevice_Platform      = "platform"
+	SyncDevice_PulledVersion = "pulled_version"
+	SyncDevice_LastPullAt    = "last_pull_at"
+	SyncDevice_LastPushAt    = "last_push_at"
+	SyncDevice_LastIp        = "last_ip"
+	SyncDevice_RevokedAt     = "revoked_at"
+)
+
+func (d *SyncDevice) TableName() string {
+	return SyncDevice_Table
+}
+
+// ListSyncDevices lists the devices of userId, one entry per synced site,
+// most recently active first.
+func ListSyncDevices(db *gorm.DB, userId uint) ([]SyncDevice, error) {
+	devices := make([]SyncDevice, 0)
+	if err := db.Where(CreatorId+" = ?", userId).
+		Order("GREATEST(" + SyncDevice_LastPullAt + ", " + SyncDevice_LastPushAt + ") DESC").
+		Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// RevokeSyncDevice revokes the device on every site. It reports false when
+// the user has no such device.
+func RevokeSyncDevice(db *gorm.DB, userId uint, deviceId string) (bool, error) {
+	rst := db.Model(&SyncDevice{}).
+		Where(CreatorId+" = ?", userId).
+		Where(SyncDevice_DeviceId+" = ?", deviceId).
+		Where(SyncDevice_RevokedAt+" IS NULL").
+		Update(SyncDevice_RevokedAt, time.Now())
+	if rst.Error != nil {
+		return false, rst.Error
+	}
+	if rst.RowsAffected > 0 {
+		return true, nil
+	}
+	var count int64
+	err := db.Model(&SyncDevice{}).
+		Where(CreatorId+" = ?", userId).
+		Where(SyncDevice_DeviceId+" = ?", deviceId).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CheckSyncDevice returns ErrDeviceRevoked when the device has been revoked on any site.
+func CheckSyncDevice(db *gorm.DB, userId uint, deviceId string) error {
+	var count int64
+	if err := db.Model(&SyncDevice{}).
+		Where(CreatorId+" = ?", userId).
+		Where(SyncDevice_DeviceId+" = ?", deviceId).
+		Where(SyncDevice_RevokedAt + " IS NOT NULL").
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDeviceRevoked
+	}
+	return nil
+}
+
+// TouchSyncDevice records that the device pulled the site at version.
+func TouchSyncDevice(db *gorm.DB, userId uint, device DeviceInfo, site int16, version int64) error {
+	return upsertSyncDevice(db, userId, device, site, map[string]any{
+		SyncDevice_PulledVersion: version,
+		SyncDevice_LastPullAt:    time.Now(),
+	})
+}
+
+// TouchSyncDevicePush records that the device pushed to the site.
+func TouchSyncDevicePush(db *gorm.DB, userId uint, device DeviceInfo, site int16) error {
+	return upsertSyncDevice(db, userId, device, site, map[string]any{
+		SyncDevice_LastPushAt: time.Now(),
+	})
+}
+
+func upsertSyncDevice(db *gorm.DB, userId uint, device DeviceInfo, site int16, updates map[string]any) error {
+	updates[SyncDevice_LastIp] = device.Ip
+	if device.Name != "" {
+		updates[SyncDevice_Name] = device.Name
+	}
+	if device.Platform != "" {
+		updates[SyncDevice_Platform] = device.Platform
+	}
+
+	row := &SyncDevice{
+		CreatorId: userId,
+		DeviceId:  device.Id,
+		Site:      site,
+		Name:      device.Name,
+		Platform:  device.Platform,
+		LastIp:    device.Ip,
+	}
+	if v, ok := updates[SyncDevice_PulledVersion].(int64); ok {
+		row.PulledVersion = v
+	}
+	if _, ok := updates[SyncDevice_LastPullAt]; ok {
+		row.LastPullAt = NewNullTime(time.Now())
+	}
+	if _, ok := updates[SyncDevice_LastPushAt]; ok {
+		row.LastPushAt = NewNullTime(time.Now())
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: CreatorId}, {Name: SyncDevice_DeviceId}, {Name: SyncDevice_Site}},
+		DoUpdates: clause.Assignments(updates),
+	}).Create(row).Error
+}
@@ -0,0 +1,518 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Sync schemas are the versions of the sync payloads, sent by clients in the
+// Only-Sync-Schema header. Schema 2 adds tiptap content patches and hlc.
+const (
+	SyncSchemaMin = 1
+	SyncSchemaMax = 2
+	// SyncSchemaUnversioned is the schema of clients predating the
+	// Only-Sync-Schema header. It is not tied to SyncSchemaMin, so that raising
+	// SyncSchemaMin past it asks these clients to upgrade.
+	SyncSchemaUnversioned = 1
+	// SyncSchemaMalformed stands for an Only-Sync-Schema header that is not a
+	// schema number, such calls are refused with code 400
+	SyncSchemaMalformed = -1
+)
+
+// SyncEntity is a table synced by the local-first clients of a site.
+type SyncEntity struct {
+	// Name keys the entity in push, pull and full sync payloads
+	Name  string
+	Table string
+	// Owner is the column holding the user id, CreatorId when empty
+	Owner string
+	// Scope narrows the table to the rows of a site, like TagV2.Group or
+	// TiptapV2.Site. Pulled rows are filtered by it and pushed records get it assigned.
+	Scope WhereMap
+	// ServerOnly columns are maintained by the server and never written by a push
+	ServerOnly []string
+	// ReadOnly entities are pulled but ignored on push
+	ReadOnly bool
+	// Added maps the columns added after SyncSchemaMin to the sync schema that
+	// introduced them. Clients speaking an older schema leave them untouched.
+	Added map[string]int
+
+	store syncStore
+	// site is the site the entity is registered with
+	site *SyncSite
+}
+
+// SyncSite is a client application and the entities it syncs, in push order.
+type SyncSite struct {
+	Id       int16
+	Name     string
+	Entities []*SyncEntity
+	// AfterPush runs inside the push transaction once all entities are written
+	AfterPush func(tx *gorm.DB, userId uint) error
+}
+
+type syncStore interface {
+	// list finds the rows matching db, live leaves out tombstones
+	list(db *gorm.DB, e *SyncEntity, live bool) (any, int64, error)
+	// stream passes the live rows matching db to emit one by one from a cursor
+	stream(db *gorm.DB, emit func(row any) error) (int64, error)
+	// push writes the records in raw, keeping the unknown columns of existing rows
+	push(tx *gorm.DB, e *SyncEntity, userId uint, raw json.RawMessage, unknown []string) ([]PushResult, error)
+	// tombstones tells whether deletes are kept as is_deleted rows
+	tombstones() bool
+}
+
+var syncSites = map[int16]*SyncSite{}
+
+// RegisterSyncSite makes site available to the sync handlers.
+func RegisterSyncSite(site *SyncSite) {
+	for _, e := range site.Entities {
+		e.site = site
+	}
+	syncSites[site.Id] = site
+}
+
+// GetSyncSite returns the registered site with the given id.
+func GetSyncSite(id int16) *SyncSite {
+	return syncSites[id]
+}
+
+// SyncSites returns every registered site.
+func SyncSites() []*SyncSite {
+	sites := make([]*SyncSite, 0, len(syncSites))
+	for _, id := range []int16{SiteDashboard, SiteJournal, SiteFlomo} {
+		if site, ok := syncSites[id]; ok {
+			sites = append(sites, site)
+		}
+	}
+	return sites
+}
+
+// Records declares a v2 entity stored as T.
+func Records[T any, P interface {
+	*T
+	pushRecord
+}](e SyncEntity) *SyncEntity {
+	e.store = recordStore[T, P]{}
+	return &e
+}
+
+// Users declares the user profile entity, stored in d_user_v2 and owned by its own id.
+func Users(e SyncEntity) *SyncEntity {
+	e.Table = UserV2_Table
+	e.Owner = Id
+	e.store = userStore{}
+	return &e
+}
+
+func (e *SyncEntity) owner() string {
+	if e.Owner == "" {
+		return CreatorId
+	}
+	return e.Owner
+}
+
+func (e *SyncEntity) scoped(db *gorm.DB, userId uint) *gorm.DB {
+	db = db.Table(e.Table).Where(e.owner()+" = ?", userId)
+	if len(e.Scope) > 0 {
+		db = db.Where(map[string]any(e.Scope))
+	}
+	return db
+}
+
+// refScope returns the scope of the rows of table that records of e may
+// reference, that of the entity of its site stored in table. Drafts of a
+// journal entry, say, must be tiptaps of the journal.
+func (e *SyncEntity) refScope(table string) WhereMap {
+	if e.site == nil {
+		return nil
+	}
+	for _, other := range e.site.Entities {
+		if other.Table == table {
+			return other.Scope
+		}
+	}
+	return nil
+}
+
+// Source returns the table and conditions of the rows userId pulls.
+func (e *SyncEntity) Source(userId uint) SyncSource {
+	where := WhereMap{e.owner(): userId}
+	for k, v := range e.Scope {
+		where[k] = v
+	}
+	return SyncSource{Table: e.Table, Where: where}
+}
+
+// Since lists the rows of userId changed after since, tombstones included,
+// along with the highest server version among them.
+func (e *SyncEntity) Since(db *gorm.DB, userId uint, since int64) (any, int64, error) {
+	return e.store.list(e.scoped(db, userId).Where(ServerVersion+" > ?", since), e, false)
+}
+
+// Full lists every live row of userId along with the highest server version among them.
+func (e *SyncEntity) Full(db *gorm.DB, userId uint) (any, int64, error) {
+	return e.store.list(e.scoped(db, userId), e, true)
+}
+
+// Push applies the records pushed in raw, a JSON array, on behalf of userId
+// by a client speaking the given sync schema.
+func (e *SyncEntity) Push(tx *gorm.DB, userId uint, schema int, raw json.RawMessage) ([]PushResult, error) {
+	if e.ReadOnly || len(raw) == 0 || string(raw) == "null" {
+		return []PushResult{}, nil
+	}
+	return e.store.push(tx, e, userId, raw, e.unknownColumns(schema))
+}
+
+// unknownColumns lists the columns a client speaking schema does not know about.
+func (e *SyncEntity) unknownColumns(schema int) []string {
+	unknown := make([]string, 0)
+	for column, added := range e.Added {
+		if added > schema {
+			unknown = append(unknown, column)
+		}
+	}
+	return unknown
+}
+
+// MatchesScope tells whether a change notified for scope concerns e, see
+// global_bump_server_version().
+func (e *SyncEntity) MatchesScope(scope string) bool {
+	for _, v := range e.Scope {
+		if fmt.Sprint(v) != scope {
+			return false
+		}
+	}
+	return true
+}
+
+// write stores a pushed record over the existing row, keeping meta, server-only
+// and unknown columns.
+func (e *SyncEntity) write(tx *gorm.DB, where map[string]any, record any, unknown []string) error {
+	omit := append([]string{Id, CreatedAt, ServerVersion, CreatorId}, e.ServerOnly...)
+	omit = append(omit, unknown...)
+	return tx.Table(e.Table).Select("*").Omit(omit...).Where(where).UpdateColumns(record).Error
+}
+
+type recordStore[T any, P interface {
+	*T
+	pushRecord
+}] struct{}
+
+func (recordStore[T, P]) list(db *gorm.DB, e *SyncEntity, live bool) (any, int64, error) {
+	if live {
+		db = db.Where(IsDeleted+" = ?", false)
+	}
+	objs := make([]T, 0)
+	if err := db.Find(&objs).Error; err != nil {
+		return nil, 0, err
+	}
+	var version int64
+	for i := range objs {
+		version = max(version, P(&objs[i]).Meta().ServerVersion)
+	}
+	return objs, version, nil
+}
+
+func (recordStore[T, P]) stream(db *gorm.DB, emit func(row any) error) (int64, error) {
+	rows, err := db.Where(IsDeleted+" = ?", false).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var version int64
+	for rows.Next() {
+		obj := new(T)
+		if err := db.ScanRows(rows, obj); err != nil {
+			return 0, err
+		}
+		version = max(version, P(obj).Meta().ServerVersion)
+		if err := emit(obj); err != nil {
+			return 0, err
+		}
+	}
+	return version, rows.Err()
+}
+
+func (recordStore[T, P]) push(tx *gorm.DB, e *SyncEntity, userId uint, raw json.RawMessage, unknown []string) ([]PushResult, error) {
+	var records []T
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", e.Name, err)
+	}
+	if len(e.Scope) > 0 {
+		if err := assignScope(records, e.Scope); err != nil {
+			return nil, err
+		}
+	}
+	return pushRecords[T, P](tx, e, userId, records, unknown)
+}
+
+func (recordStore[T, P]) tombstones() bool {
+	return true
+}
+
+var recordSchemas sync.Map
+
+// assignScope sets the scope columns on every record.
+func assignScope[T any](records []T, scope WhereMap) error {
+	s, err := schema.Parse(new(T), &recordSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+	for column, value := range scope {
+		field := s.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("unknown scope column %s of %s", column, s.Table)
+		}
+		for i := range records {
+			if err := field.Set(context.Background(), reflect.ValueOf(&records[i]).Elem(), value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// keepColumns copies the given columns of server into record.
+func keepColumns[T any](server, record *T, columns []string) error {
+	if len(columns) == 0 {
+		return nil
+	}
+	s, err := schema.Parse(new(T), &recordSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+	from, to := reflect.ValueOf(server).Elem(), reflect.ValueOf(record).Elem()
+	for _, column := range columns {
+		field := s.LookUpField(column)
+		if field == nil {
+			return fmt.Errorf("unknown column %s of %s", column, s.Table)
+		}
+		value, _ := field.ValueOf(context.Background(), from)
+		if err := field.Set(context.Background(), to, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type userStore struct{}
+
+func (userStore) list(db *gorm.DB, e *SyncEntity, live bool) (any, int64, error) {
+	users := make([]UserV2View, 0)
+	if err := db.Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	var version int64
+	for i := range users {
+		version = max(version, users[i].ServerVersion)
+	}
+	return users, version, nil
+}
+
+func (userStore) stream(db *gorm.DB, emit func(row any) error) (int64, error) {
+	rows, err := db.Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var version int64
+	for rows.Next() {
+		user := new(UserV2View)
+		if err := db.ScanRows(rows, user); err != nil {
+			return 0, err
+		}
+		version = max(version, user.ServerVersion)
+		if err := emit(user); err != nil {
+			return 0, err
+		}
+	}
+	return version, rows.Err()
+}
+
+func (userStore) tombstones() bool {
+	return false
+}
+
+func (userStore) push(tx *gorm.DB, e *SyncEntity, userId uint, raw json.RawMessage, unknown []string) ([]PushResult, error) {
+	var views []UserV2View
+	if err := json.Unmarshal(raw, &views); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", e.Name, err)
+	}
+	return pushUsers(tx, e, userId, views, unknown)
+}
+
+// snapshotTx reads every entity of a site from the same snapshot
+var snapshotTx = &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+
+// syncWriterLock is the advisory lock class of LockSyncWriter
+const syncWriterLock = 7301
+
+// LockSyncWriter makes tx the only transaction writing the synced rows of
+// userId until it ends. Server versions are drawn when rows are written but
+// become visible on commit, so two concurrent pushes could commit out of order
+// and a pull in between would move past the rows of the slower one. Every
+// write to a synced table has to hold it.
+func LockSyncWriter(tx *gorm.DB, userId uint) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", syncWriterLock, int32(userId)).Error
+}
+
+// Push applies a push payload keyed by entity name, sent by device, inside tx
+// and reports the outcome of every record. Discarded versions are logged as
+// SyncConflict. The transaction must be rolled back on error.
+func (s *SyncSite) Push(tx *gorm.DB, userId uint, device DeviceInfo, payload map[string]json.RawMessage, results PushResults) error {
+	if err := LockSyncWriter(tx, userId); err != nil {
+		return err
+	}
+	for _, e := range s.Entities {
+		if e.ReadOnly {
+			continue
+		}
+		rs, err := e.Push(tx, userId, device.Schema, payload[e.Name])
+		results[e.Name] = rs
+		if err != nil {
+			return err
+		}
+		if err := logConflicts(tx, s.Id, e, userId, device.Id, rs); err != nil {
+			return err
+		}
+	}
+	if s.AfterPush != nil {
+		return s.AfterPush(tx, userId)
+	}
+	return nil
+}
+
+// Pull lists the rows of every entity changed after since, at most limit rows
+// when limit is positive. It returns the rows keyed by entity name, the server
+// version to pull from next and whether more rows are left.
+// All entities are read from one snapshot and the writers of synced rows
+// (pushes, conflict resolutions, re-encrypted secrets and entry review counts)
+// commit in server version order, see LockSyncWriter, so no row below the
+// returned version can show up later.
+func (s *SyncSite) Pull(db *gorm.DB, userId uint, since int64, limit int) (map[string]any, int64, bool, error) {
+	sources := make([]SyncSource, len(s.Entities))
+	for i, e := range s.Entities {
+		sources[i] = e.Source(userId)
+	}
+
+	var (
+		rows    map[string]any
+		version int64
+		hasMore bool
+	)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		bound, more, err := PullBound(tx, sources, since, limit)
+		if err != nil {
+			return err
+		}
+		hasMore = more
+		tx = UpTo(tx, bound)
+		rows, version, err = s.collect(func(e *SyncEntity) (any, int64, error) {
+			return e.Since(tx, userId, since)
+		})
+		return err
+	}, snapshotTx)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return rows, max(version, since), hasMore, nil
+}
+
+// Diff replaces pulled documents by patches against what the client pulled at
+// since, see DiffTiptapV2.
+func (s *SyncSite) Diff(db *gorm.DB, rows map[string]any, since int64) error {
+	for _, e := range s.Entities {
+		if docs, ok := rows[e.Name].([]TiptapV2); ok {
+			if err := DiffTiptapV2(db, docs, since); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Full lists every live row of every entity keyed by entity name, along with
+// the server version to pull from next. All entities are read from one snapshot.
+func (s *SyncSite) Full(db *gorm.DB, userId uint) (map[string]any, int64, error) {
+	var (
+		rows    map[string]any
+		version int64
+	)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rows, version, err = s.collect(func(e *SyncEntity) (any, int64, error) {
+			return e.Full(tx, userId)
+		})
+		if err != nil {
+			return err
+		}
+		version, err = s.cursor(tx, userId, version)
+		return err
+	}, snapshotTx)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, version, nil
+}
+
+// Stream passes every live row of every entity to emit, entity by entity,
+// straight from a database cursor. All entities are read from one snapshot, so
+// the returned server version to pull from next covers every emitted row.
+func (s *SyncSite) Stream(db *gorm.DB, userId uint, emit func(entity string, row any) error) (int64, error) {
+	var version int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, e := range s.Entities {
+			v, err := e.store.stream(e.scoped(tx, userId), func(row any) error {
+				return emit(e.Name, row)
+			})
+			if err != nil {
+				return err
+			}
+			version = max(version, v)
+		}
+		var err error
+		version, err = s.cursor(tx, userId, version)
+		return err
+	}, snapshotTx)
+	return version, err
+}
+
+// cursor returns the server version a full sync of the live rows up to version
+// pulls from next. It is never below the purge watermark, or the newest
+// changes being purged deletions would make every pull from it fail.
+func (s *SyncSite) cursor(tx *gorm.DB, userId uint, version int64) (int64, error) {
+	purged, err := GetPurgedVersion(tx, userId, s.Id)
+	if err != nil {
+		return 0, err
+	}
+	return fullSyncCursor(version, purged), nil
+}
+
+func fullSyncCursor(version, purged int64) int64 {
+	return max(version, purged, 1)
+}
+
+// collect runs list for every entity.
+func (s *SyncSite) collect(list func(e *SyncEntity) (any, int64, error)) (map[string]any, int64, error) {
+	rows := make(map[string]any, len(s.Entities))
+	var version int64
+	for _, e := range s.Entities {
+		objs, v, err := list(e)
+		if err != nil {
+			return nil, 0, err
+		}
+		rows[e.Name] = objs
+		version = max(version, v)
+	}
+	return rows, version, nil
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullSyncCursor(t *testing.T) {
+	t.Run("Pull from the cursor succeeds once the newest tombstone is purged", func(t *testing.T) {
+		// live rows up to version 5, the deletion at version 7 has been purged
+		live, purged := int64(5), int64(7)
+		cursor := fullSyncCursor(live, purged)
+		assert.Equal(t, int64(7), cursor)
+		assert.False(t, NeedsFullSync(cursor, purged))
+		assert.True(t, NeedsFullSync(live, purged))
+	})
+
+	t.Run("Cursor follows the live rows above the watermark", func(t *testing.T) {
+		assert.Equal(t, int64(9), fullSyncCursor(9, 7))
+	})
+
+	t.Run("Empty site starts at 1", func(t *testing.T) {
+		assert.Equal(t, int64(1), fullSyncCursor(0, 0))
+	})
+}
@@ -0,0 +1,48 @@
+package model
+
+func init() {
+	RegisterSyncSite(&SyncSite{
+		Id:   SiteDashboard,
+		Name: "dashboard",
+		Entities: []*SyncEntity{
+			Users(SyncEntity{Name: "users", ServerOnly: []string{UserV2_Email}}),
+			Records[TagV2](SyncEntity{Name: "tags", Table: TagV2_Table, Scope: WhereMap{TagV2_Group: "dashboard"}}),
+			// drafts are pushed before the rows written in them
+			Records[TiptapV2](SyncEntity{Name: "tiptaps", Table: TiptapV2_Table, Scope: WhereMap{TiptapV2_Site: SiteDashboard}}),
+			Records[BlogV2](SyncEntity{Name: "blogs", Table: BlogV2_Table}),
+			Records[BookmarkV2](SyncEntity{Name: "bookmarks", Table: BookmarkV2_Table}),
+			Records[CollectionV2](SyncEntity{Name: "collections", Table: CollectionV2_Table}),
+			Records[EchoV2](SyncEntity{Name: "echoes", Table: EchoV2_Table}),
+			Records[QuickNoteV2](SyncEntity{Name: "quickNotes", Table: QuickNoteV2_Table}),
+			Records[TodoV2](SyncEntity{Name: "todos", Table: TodoV2_Table}),
+			Records[WatchV2](SyncEntity{Name: "watches", Table: WatchV2_Table}),
+		},
+	})
+
+	RegisterSyncSite(&SyncSite{
+		Id:   SiteJournal,
+		Name: "journal",
+		Entities: []*SyncEntity{
+			Users(SyncEntity{Name: "users", ReadOnly: true}),
+			// drafts are pushed before the entries written in them
+			Records[TiptapV2](SyncEntity{Name: "tiptaps", Table: TiptapV2_Table, Scope: WhereMap{TiptapV2_Site: SiteJournal}}),
+			Records[EntryV2](SyncEntity{Name: "entries", Table: EntryV2_Table, ServerOnly: []string{EntryV2_ReviewCount}}),
+			Records[TagV2](SyncEntity{Name: "tags", Table: TagV2_Table, Scope: WhereMap{TagV2_Group: "journal"}}),
+			Records[StatisticV2](SyncEntity{Name: "statistics", Table: StatisticV2_Table, ReadOnly: true}),
+		},
+		// Recalculate statistics together with the synced entries
+		AfterPush: CalculateStatistics,
+	})
+
+	RegisterSyncSite(&SyncSite{
+		Id:   SiteFlomo,
+		Name: "flomo",
+		Entities: []*SyncEntity{
+			Users(SyncEntity{Name: "users", ReadOnly: true}),
+			// folders and drafts are pushed before the cards filed in them
+			Records[Folder](SyncEntity{Name: "folders", Table: Folder_Table}),
+			Records[TiptapV2](SyncEntity{Name: "tiptaps", Table: TiptapV2_Table, Scope: WhereMap{TiptapV2_Site: SiteFlomo}}),
+			Records[Card](SyncEntity{Name: "cards", Table: Card_Table, ServerOnly: []string{Card_ReviewCount}}),
+		},
+	})
+}
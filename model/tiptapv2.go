@@ -1,8 +1,12 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/google/uuid"
+	"github.com/wI2L/jsondiff"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -10,6 +14,15 @@ import (
 type TiptapV2 struct {
 	MetaFieldV2
 	TiptapV2Field
+	TiptapV2Delta
+}
+
+// TiptapV2Delta carries Content as a JSON Patch (RFC 6902) instead of the whole
+// document. A pushed patch applies to the content at the record's serverVersion,
+// a pulled one to the content at ContentBase.
+type TiptapV2Delta struct {
+	ContentPatch json.RawMessage `gorm:"-" json:"contentPatch,omitempty"`
+	ContentBase  int64           `gorm:"-" json:"contentBase,omitempty"`
 }
 
 type TiptapV2Field struct {
@@ -49,49 +62,83 @@ func ListTiptapV2(db *gorm.DB, where map[string]any) ([]TiptapV2, error) {
 	return objs, nil
 }
 
-func ListTiptapV2Since(db *gorm.DB, since int64, creatorId uint, site int16) ([]TiptapV2, error) {
-	var objs []TiptapV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(TiptapV2_Site, site)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
+func (t *TiptapV2) Create(db *gorm.DB) error {
+	return db.Create(t).Error
+}
 
-	rst := db.Find(&objs)
-	if rst.Error != nil {
-		return nil, rst.Error
-	}
-	return objs, nil
+func (t *TiptapV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
+	return db.Model(t).Where(where).Update(IsDeleted, true).Error
 }
 
-func FullTiptapV2(db *gorm.DB, creatorId uint, site int16) ([]TiptapV2, error) {
-	var objs []TiptapV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(TiptapV2_Site, site)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
+// patched tells whether the content was pushed as a patch.
+func (t *TiptapV2) patched() bool {
+	return len(t.ContentPatch) > 0
+}
 
-	rst := db.Find(&objs)
-	if rst.Error != nil {
-		return nil, rst.Error
+// applyPatch sets the content to the patch applied on the content of server.
+func (t *TiptapV2) applyPatch(server *TiptapV2) error {
+	patch, err := jsonpatch.DecodePatch(t.ContentPatch)
+	if err != nil {
+		return fmt.Errorf("invalid content patch: %w", err)
 	}
-	return objs, nil
+	content, err := patch.Apply(server.Content)
+	if err != nil {
+		return fmt.Errorf("failed to apply content patch: %w", err)
+	}
+	t.Content = content
+	t.ContentPatch = nil
+	return nil
 }
 
-func (t *TiptapV2) Create(db *gorm.DB) error {
-	return db.Create(t).Error
-}
+// DiffTiptapV2 replaces the content of docs by a patch from the revision the
+// client pulled at since, when that revision is known and the patch is smaller
+// than the document.
+func DiffTiptapV2(db *gorm.DB, docs []TiptapV2, since int64) error {
+	if len(docs) == 0 || since == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(docs))
+	for i := range docs {
+		ids[i] = docs[i].Id
+	}
 
-func (t *TiptapV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).UpdateColumns(t).Error
-}
+	var bases []struct {
+		RecordId      uuid.UUID
+		ServerVersion int64
+		Content       datatypes.JSON
+	}
+	if err := db.Raw("SELECT DISTINCT ON ("+SyncRevision_RecordId+") "+
+		SyncRevision_RecordId+", "+SyncRevision_ServerVersion+", payload->'"+TiptapV2_Content+"' AS content"+
+		" FROM "+SyncRevision_Table+
+		" WHERE "+SyncRevision_Tbl+" = ? AND "+SyncRevision_RecordId+" IN ? AND "+SyncRevision_ServerVersion+" <= ?"+
+		" ORDER BY "+SyncRevision_RecordId+", "+SyncRevision_ServerVersion+" DESC",
+		TiptapV2_Table, ids, since).Scan(&bases).Error; err != nil {
+		return err
+	}
+	byId := make(map[uuid.UUID]int, len(bases))
+	for i := range bases {
+		byId[bases[i].RecordId] = i
+	}
 
-func (t *TiptapV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
-	return db.Model(t).Where(where).Update(IsDeleted, true).Error
+	for i := range docs {
+		j, ok := byId[docs[i].Id]
+		if !ok || (docs[i].IsDeleted != nil && *docs[i].IsDeleted) {
+			continue
+		}
+		patch, err := jsondiff.CompareJSON(bases[j].Content, docs[i].Content, jsondiff.LCS())
+		if err != nil {
+			return err
+		}
+		raw, err := json.Marshal(patch)
+		if err != nil {
+			return err
+		}
+		if len(raw) >= len(docs[i].Content) {
+			continue
+		}
+		docs[i].ContentPatch = raw
+		docs[i].ContentBase = bases[j].ServerVersion
+		docs[i].Content = nil
+	}
+	return nil
 }
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wI2L/jsondiff"
+)
+
+func TestTiptapV2Patch(t *testing.T) {
+	server := &TiptapV2{}
+	server.Content = []byte(`{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"hello"}]}]}`)
+
+	t.Run("Patch is applied to the server content", func(t *testing.T) {
+		doc := &TiptapV2{}
+		doc.ContentPatch = []byte(`[{"op":"replace","path":"/content/0/content/0/text","value":"hello world"}]`)
+
+		require.NoError(t, doc.applyPatch(server))
+		assert.Nil(t, doc.ContentPatch)
+		assert.JSONEq(t, `{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"hello world"}]}]}`, string(doc.Content))
+	})
+
+	t.Run("Patch not matching the content fails", func(t *testing.T) {
+		doc := &TiptapV2{}
+		doc.ContentPatch = []byte(`[{"op":"remove","path":"/content/3"}]`)
+
+		assert.Error(t, doc.applyPatch(server))
+	})
+
+	t.Run("Pulled diff applies back to the target", func(t *testing.T) {
+		target := []byte(`{"type":"doc","content":[{"type":"paragraph","content":[{"type":"text","text":"hello"}]},{"type":"paragraph"}]}`)
+		patch, err := jsondiff.CompareJSON(server.Content, target, jsondiff.LCS())
+		require.NoError(t, err)
+		raw, err := json.Marshal(patch)
+		require.NoError(t, err)
+
+		doc := &TiptapV2{}
+		doc.ContentPatch = raw
+		require.NoError(t, doc.applyPatch(server))
+		assert.JSONEq(t, string(target), string(doc.Content))
+	})
+}
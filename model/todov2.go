@@ -34,6 +34,11 @@ func (t *TodoV2) TableName() string {
 	return TodoV2_Table
 }
 
+func (t *TodoV2) check(c *PushCheck) {
+	c.Ref("collectionId", CollectionV2_Table, t.CollectionId, false)
+	c.Ref("draft", TiptapV2_Table, t.Draft, false)
+}
+
 func (t *TodoV2) Get(db *gorm.DB, where map[string]any) error {
 	rst := db.Where(where).Find(&t)
 	if rst.Error != nil {
@@ -45,43 +50,10 @@ func (t *TodoV2) Get(db *gorm.DB, where map[string]any) error {
 	return nil
 }
 
-func ListTodoV2Since(db *gorm.DB, since int64, creatorId uint) ([]TodoV2, error) {
-	var objs []TodoV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
-func FullTodoV2(db *gorm.DB, creatorId uint) ([]TodoV2, error) {
-	var objs []TodoV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
 func (t *TodoV2) Create(db *gorm.DB) error {
 	return db.Create(t).Error
 }
 
-func (t *TodoV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).UpdateColumns(t).Error
-}
-
 func (t *TodoV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
 	return db.Model(t).Where(where).Update(IsDeleted, true).Error
 }
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SyncPurge keeps the highest server version of the tombstones purged for a
+// user and site. Pulls from below it may have missed deletions.
+type SyncPurge struct {
+	CreatorId     uint  `gorm:"column:creator_id;primaryKey"`
+	Site          int16 `gorm:"column:site;primaryKey"`
+	PurgedVersion int64 `gorm:"column:purged_version"`
+}
+
+const (
+	SyncPurge_Table         = "d_sync_purge"
+	SyncPurge_Site          = "site"
+	SyncPurge_PurgedVersion = "purged_version"
+)
+
+func (p *SyncPurge) TableName() string {
+	return SyncPurge_Table
+}
+
+// GetPurgedVersion returns the purge watermark of the user and site, 0 when
+// nothing has been purged.
+func GetPurgedVersion(db *gorm.DB, userId uint, site int16) (int64, error) {
+	var versions []int64
+	if err := db.Model(&SyncPurge{}).
+		Where(CreatorId+" = ?", userId).
+		Where(SyncPurge_Site+" = ?", site).
+		Pluck(SyncPurge_PurgedVersion, &versions).Error; err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[0], nil
+}
+
+// NeedsFullSync tells whether a pull from since may have missed deletions
+// purged up to the purge watermark.
+func NeedsFullSync(since, purged int64) bool {
+	return since < purged
+}
+
+// CompactTombstones purges the tombstones that every device which pulled since
+// activeSince has already seen and returns the number of purged rows. Devices
+// idle for longer fall below the purge watermark and have to full sync. When
+// every device of a user is idle, only what all of them have seen is purged.
+// Users without a device that pulled keep every tombstone.
+func CompactTombstones(db *gorm.DB, activeSince time.Time) (int64, error) {
+	var userIds []uint
+	if err := db.Table(UserV2_Table).Pluck(Id, &userIds).Error; err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, userId := range userIds {
+		for _, site := range SyncSites() {
+			n, err := site.compact(db, userId, activeSince)
+			if err != nil {
+				return total, err
+			}
+			total += n
+		}
+	}
+	return total, nil
+}
+
+func (s *SyncSite) compact(db *gorm.DB, userId uint, activeSince time.Time) (int64, error) {
+	active, err := s.acknowledged(db, userId, &activeSince)
+	if err != nil {
+		return 0, err
+	}
+	var ever sql.NullInt64
+	if !active.Valid {
+		if ever, err = s.acknowledged(db, userId, nil); err != nil {
+			return 0, err
+		}
+	}
+	upTo, ok := purgeLimit(active, ever)
+	if !ok {
+		return 0, nil
+	}
+
+	var total int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var purged int64
+		for _, e := range s.Entities {
+			if !e.store.tombstones() {
+				continue
+			}
+			n, version, err := e.purge(tx, userId, upTo)
+			if err != nil {
+				return err
+			}
+			total += n
+			purged = max(purged, version)
+		}
+		if purged == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: CreatorId}, {Name: SyncPurge_Site}},
+			DoUpdates: clause.Assignments(map[string]any{
+				SyncPurge_PurgedVersion: gorm.Expr("GREATEST(" + SyncPurge_Table + "." + SyncPurge_PurgedVersion + ", EXCLUDED." + SyncPurge_PurgedVersion + ")"),
+			}),
+		}).Create(&SyncPurge{CreatorId: userId, Site: s.Id, PurgedVersion: purged}).Error
+	})
+	return total, err
+}
+
+// purgeLimit returns the server version tombstones are purged up to, given
+// the lowest version acknowledged by the active devices and by every device.
+// Without active devices, what idle devices have not seen yet is kept rather
+// than purged unseen. Without any device that pulled, clients which do not
+// identify themselves may still rely on the tombstones, so nothing is purged.
+func purgeLimit(active, ever sql.NullInt64) (int64, bool) {
+	switch {
+	case active.Valid:
+		return active.Int64, true
+	case ever.Valid:
+		return ever.Int64, true
+	}
+	return 0, false
+}
+
+// acknowledged returns the lowest server version acknowledged by the devices
+// of userId which pulled the site since activeSince, or ever when it is nil.
+// Revoked devices and devices which never pulled hold nothing back.
+func (s *SyncSite) acknowledged(db *gorm.DB, userId uint, activeSince *time.Time) (sql.NullInt64, error) {
+	query := db.Model(&SyncDevice{}).
+		Select("MIN("+SyncDevice_PulledVersion+")").
+		Where(CreatorId+" = ?", userId).
+		Where(SyncDevice_Site+" = ?", s.Id).
+		Where(SyncDevice_RevokedAt + " IS NULL").
+		Where(SyncDevice_LastPullAt + " IS NOT NULL")
+	if activeSince != nil {
+		query = query.Where(SyncDevice_LastPullAt+" >= ?", *activeSince)
+	}
+	var pulled sql.NullInt64
+	err := query.Scan(&pulled).Error
+	return pulled, err
+}
+
+// purge deletes the tombstones of userId up to version and returns how many
+// were deleted along with the highest server version among them.
+func (e *SyncEntity) purge(tx *gorm.DB, userId uint, version int64) (int64, int64, error) {
+	query := "DELETE FROM " + e.Table + " WHERE " + e.owner() + " = ? AND " + IsDeleted + " AND " + ServerVersion + " <= ?"
+	args := []any{userId, version}
+	for column, value := range e.Scope {
+		query += " AND " + column + " = ?"
+		args = append(args, value)
+	}
+
+	var rst struct {
+		Count   int64
+		Version int64
+	}
+	if err := tx.Raw("WITH d AS ("+query+" RETURNING "+ServerVersion+")"+
+		" SELECT COUNT(*) AS count, COALESCE(MAX("+ServerVersion+"), 0) AS version FROM d", args...).
+		Scan(&rst).Error; err != nil {
+		return 0, 0, err
+	}
+	return rst.Count, rst.Version, nil
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPurgeLimit(t *testing.T) {
+	t.Run("Active devices bound the purge", func(t *testing.T) {
+		upTo, ok := purgeLimit(sql.NullInt64{Int64: 7, Valid: true}, sql.NullInt64{})
+		assert.True(t, ok)
+		assert.Equal(t, int64(7), upTo)
+	})
+
+	t.Run("Idle devices keep what they have not seen", func(t *testing.T) {
+		upTo, ok := purgeLimit(sql.NullInt64{}, sql.NullInt64{Int64: 3, Valid: true})
+		assert.True(t, ok)
+		assert.Equal(t, int64(3), upTo)
+	})
+
+	t.Run("Without devices that pulled nothing is purged", func(t *testing.T) {
+		_, ok := purgeLimit(sql.NullInt64{}, sql.NullInt64{})
+		assert.False(t, ok)
+	})
+}
+
+func TestCompactTombstones(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.Close()
+	require.NoError(t, db.AutoMigrate(&SyncDevice{}, &TodoV2{}))
+
+	deleted := true
+	tombstone := testTodo("buy milk", false, 100)
+	tombstone.Id = uuid.New()
+	tombstone.CreatorId = 1
+	tombstone.ServerVersion = 5
+	tombstone.IsDeleted = &deleted
+	require.NoError(t, db.Create(tombstone).Error)
+	site := &SyncSite{Id: SiteDashboard, Entities: []*SyncEntity{
+		{Name: "todos", Table: TodoV2_Table, store: recordStore[TodoV2, *TodoV2]{}},
+	}}
+
+	t.Run("User with no registered devices keeps tombstones", func(t *testing.T) {
+		// a device that only pushed tells nothing about what was seen
+		require.NoError(t, db.Create(&SyncDevice{CreatorId: 1, DeviceId: "device-1", Site: SiteDashboard,
+			LastPushAt: NewNullTime(time.Now())}).Error)
+
+		n, err := site.compact(db, 1, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Zero(t, n)
+		var count int64
+		require.NoError(t, db.Model(&TodoV2{}).Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+	})
+}
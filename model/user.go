@@ -84,3 +84,49 @@ func CreateUser(db *gorm.DB, email string) (uint, error) {
 func (u *User) Update(db *gorm.DB, where map[string]any) error {
 	return db.Where(where).Updates(u).Error
 }
+
+// UserSecrets are the encrypted credentials of a user, the same columns in
+// d_user and d_user_v2.
+type UserSecrets struct {
+	Id         uint   `gorm:"column:id"`
+	RssToken   string `gorm:"column:rss_token"`
+	EmailToken string `gorm:"column:email_token"`
+}
+
+// ListUserSecrets lists the users of table having a credential stored.
+func ListUserSecrets(db *gorm.DB, table string) ([]UserSecrets, error) {
+	secrets := make([]UserSecrets, 0)
+	if err := db.Table(table).
+		Select(Id, User_RssToken, User_EmailToken).
+		Where(User_RssToken + " <> '' OR " + User_EmailToken + " <> ''").
+		Order(Id).
+		Find(&secrets).Error; err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// ReplaceUserSecrets writes next over the credentials of a user of table,
+// unless they changed since prev was read. It tells whether they were written.
+// d_user_v2 is synced, so it is written holding LockSyncWriter like a push.
+func ReplaceUserSecrets(db *gorm.DB, table string, prev, next UserSecrets) (bool, error) {
+	written := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if table == UserV2_Table {
+			if err := LockSyncWriter(tx, prev.Id); err != nil {
+				return err
+			}
+		}
+		rst := tx.Table(table).
+			Where(Id+" = ?", prev.Id).
+			Where(User_RssToken+" = ?", prev.RssToken).
+			Where(User_EmailToken+" = ?", prev.EmailToken).
+			Updates(map[string]any{
+				User_RssToken:   next.RssToken,
+				User_EmailToken: next.EmailToken,
+			})
+		written = rst.RowsAffected > 0
+		return rst.Error
+	})
+	return written, err
+}
@@ -18,6 +18,7 @@ type UserV2 struct {
 type UserV2View struct {
 	UpdatedAt     int64  `json:"updatedAt"`
 	ServerVersion int64  `json:"serverVersion"`
+	Hlc           int64  `gorm:"column:hlc;not null;default:0" json:"hlc"`
 	Avatar        string `gorm:"size:1024" json:"avatar"`
 	Email         string `gorm:"size:100;uniqueIndex;not null" json:"email"`
 	Username      string `gorm:"size:255" json:"username"`
@@ -38,30 +39,6 @@ func (u *UserV2) TableName() string {
 	return UserV2_Table
 }
 
-func FullUsers(db *gorm.DB, creatorId uint) ([]UserV2View, error) {
-	var users []UserV2View
-	if err := db.Table(UserV2_Table).Where(Id, creatorId).Find(&users).Error; err != nil {
-		return nil, err
-	}
-	return users, nil
-}
-
-func ListUserSince(db *gorm.DB, since int64, creatorId uint) ([]UserV2View, error) {
-	var users []UserV2View
-
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(Id, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-
-	if err := db.Table(UserV2_Table).Find(&users).Error; err != nil {
-		return nil, err
-	}
-	return users, nil
-}
-
 func CreateEmailToIDMapV2(db *gorm.DB) (map[string]uint, error) {
 	var users []UserV2
 
@@ -107,8 +84,3 @@ func CreateUserV2(db *gorm.DB, email string) (uint, error) {
 	}
 	return user.Id, nil
 }
-
-func (u *UserV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Omit(UserV2_RssToken, UserV2_EmailToken, UserV2_EmailFeed).Where(where).UpdateColumns(u).Error
-}
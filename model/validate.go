@@ -0,0 +1,182 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// PushCheck collects what is wrong with a pushed record. References are only
+// recorded by the checks and resolved for all records of a push at once.
+type PushCheck struct {
+	problems []string
+	refs     []pushRef
+}
+
+type pushRef struct {
+	field string
+	table string
+	id    uuid.UUID
+}
+
+// checkedRecord is implemented by records with constraints beyond their column types.
+type checkedRecord interface {
+	check(c *PushCheck)
+}
+
+// Enum requires value to be one of allowed.
+func (c *PushCheck) Enum(field, value string, allowed ...string) {
+	if !slices.Contains(allowed, value) {
+		c.problems = append(c.problems, fmt.Sprintf("%s must be one of %s", field, strings.Join(allowed, ", ")))
+	}
+}
+
+// Ref requires id to be a live row of table owned by the pushing user, in the
+// scope of the site pushing when it syncs table. The zero id stands for no
+// reference and is accepted unless required is set.
+func (c *PushCheck) Ref(field, table string, id uuid.UUID, required bool) {
+	if id == uuid.Nil {
+		if required {
+			c.problems = append(c.problems, field+" is required")
+		}
+		return
+	}
+	c.refs = append(c.refs, pushRef{field: field, table: table, id: id})
+}
+
+func (c *PushCheck) valid() bool {
+	return len(c.problems) == 0
+}
+
+func (c *PushCheck) reason() string {
+	return strings.Join(c.problems, "; ")
+}
+
+var varcharType = regexp.MustCompile(`^varchar\((\d+)\)$`)
+
+// checkLengths reports the string fields of record longer than their column.
+func checkLengths[T any](record *T, c *PushCheck) error {
+	s, err := schema.Parse(record, &recordSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+	value := reflect.ValueOf(record).Elem()
+	for _, field := range s.Fields {
+		if field.GORMDataType != schema.String {
+			continue
+		}
+		limit := field.Size
+		if m := varcharType.FindStringSubmatch(strings.ToLower(string(field.DataType))); m != nil {
+			limit, _ = strconv.Atoi(m[1])
+		}
+		if limit <= 0 {
+			continue
+		}
+		v, _ := field.ValueOf(context.Background(), value)
+		if str, ok := v.(string); ok && utf8.RuneCountInString(str) > limit {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			c.problems = append(c.problems, fmt.Sprintf("%s is longer than %d characters", name, limit))
+		}
+	}
+	return nil
+}
+
+// checkRecords validates the pushed records keyed by id and returns the
+// problems of the invalid ones. Tombstones are not validated. References to
+// rows of the pushed table are also satisfied by the valid records of the push,
+// and not by the rows it deletes.
+func checkRecords[T any, P interface {
+	*T
+	pushRecord
+}](tx *gorm.DB, e *SyncEntity, userId uint, records map[string]P) (map[string]string, error) {
+	checks := make(map[string]*PushCheck, len(records))
+	deleted := make([]uuid.UUID, 0)
+	for id, record := range records {
+		if d := record.Meta().IsDeleted; d != nil && *d {
+			deleted = append(deleted, record.Meta().Id)
+			continue
+		}
+		c := &PushCheck{}
+		if err := checkLengths((*T)(record), c); err != nil {
+			return nil, err
+		}
+		if r, ok := any(record).(checkedRecord); ok {
+			r.check(c)
+		}
+		checks[id] = c
+	}
+
+	wanted := map[string][]uuid.UUID{}
+	for _, c := range checks {
+		for _, ref := range c.refs {
+			wanted[ref.table] = append(wanted[ref.table], ref.id)
+		}
+	}
+	found := map[string]map[uuid.UUID]bool{}
+	for table, ids := range wanted {
+		query := tx.Table(table).
+			Where(CreatorId+" = ?", userId).
+			Where(Id+" IN ?", ids).
+			Where(IsDeleted+" = ?", false)
+		if scope := e.refScope(table); len(scope) > 0 {
+			query = query.Where(map[string]any(scope))
+		}
+		var owned []uuid.UUID
+		if err := query.Pluck(Id, &owned).Error; err != nil {
+			return nil, err
+		}
+		found[table] = make(map[uuid.UUID]bool, len(owned))
+		for _, id := range owned {
+			found[table][id] = true
+		}
+	}
+	for id, c := range checks {
+		if c.valid() && e.Table != "" {
+			if found[e.Table] == nil {
+				found[e.Table] = map[uuid.UUID]bool{}
+			}
+			found[e.Table][uuid.MustParse(id)] = true
+		}
+	}
+	for _, id := range deleted {
+		delete(found[e.Table], id)
+	}
+
+	invalid := map[string]string{}
+	for id, c := range checks {
+		for _, ref := range c.refs {
+			if !found[ref.table][ref.id] {
+				c.problems = append(c.problems, fmt.Sprintf("%s %s does not exist", ref.field, ref.id))
+			}
+		}
+		if !c.valid() {
+			invalid[id] = c.reason()
+		}
+	}
+	return invalid, nil
+}
+
+// foreignIds returns the ids among ids stored in table for another user than userId.
+func foreignIds(tx *gorm.DB, table string, userId uint, ids []string) (map[string]bool, error) {
+	var taken []string
+	if err := tx.Table(table).
+		Where(CreatorId+" <> ?", userId).
+		Where(Id+" IN ?", ids).
+		Pluck(Id, &taken).Error; err != nil {
+		return nil, err
+	}
+	foreign := make(map[string]bool, len(taken))
+	for _, id := range taken {
+		foreign[id] = true
+	}
+	return foreign, nil
+}
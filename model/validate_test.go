@@ -0,0 +1,116 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPushCheck(t *testing.T) {
+	t.Run("Valid record has no problems", func(t *testing.T) {
+		watch := &WatchV2{}
+		watch.Type, watch.Status, watch.Title = "Movie", "Watching", "Perfect Days"
+
+		c := &PushCheck{}
+		require.NoError(t, checkLengths(watch, c))
+		watch.check(c)
+		assert.True(t, c.valid())
+	})
+
+	t.Run("Enums and lengths are enforced", func(t *testing.T) {
+		watch := &WatchV2{}
+		watch.Type, watch.Status, watch.Title = "Movie", "Paused", strings.Repeat("字", 1025)
+
+		c := &PushCheck{}
+		require.NoError(t, checkLengths(watch, c))
+		watch.check(c)
+		assert.Len(t, c.problems, 2)
+		assert.Contains(t, c.reason(), "title is longer than 1024 characters")
+		assert.Contains(t, c.reason(), "status must be one of")
+	})
+
+	t.Run("References are collected, required ones must be set", func(t *testing.T) {
+		entry := &EntryV2{}
+		c := &PushCheck{}
+		entry.check(c)
+		assert.Equal(t, "draft is required", c.reason())
+
+		card := &Card{}
+		card.Draft = uuid.New()
+		c = &PushCheck{}
+		card.check(c)
+		assert.True(t, c.valid())
+		assert.Equal(t, []pushRef{{field: "draft", table: TiptapV2_Table, id: card.Draft}}, c.refs)
+	})
+}
+
+func TestCheckRecordReferences(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.Close()
+	// only the columns the references are resolved by
+	for _, table := range []string{TiptapV2_Table, Folder_Table} {
+		require.NoError(t, db.Exec(`CREATE TABLE `+table+` (id text PRIMARY KEY, creator_id integer,
+			site integer DEFAULT 0, is_deleted boolean DEFAULT false)`).Error)
+	}
+	insert := func(table string, site int16, deleted bool) uuid.UUID {
+		id := uuid.New()
+		require.NoError(t, db.Exec(`INSERT INTO `+table+` (id, creator_id, site, is_deleted) VALUES (?, 1, ?, ?)`,
+			id, site, deleted).Error)
+		return id
+	}
+
+	folders := &SyncEntity{Name: "folders", Table: Folder_Table}
+	cards := &SyncEntity{Name: "cards", Table: Card_Table}
+	site := &SyncSite{Id: SiteFlomo, Entities: []*SyncEntity{
+		folders,
+		{Name: "tiptaps", Table: TiptapV2_Table, Scope: WhereMap{TiptapV2_Site: SiteFlomo}},
+		cards,
+	}}
+	for _, e := range site.Entities {
+		e.site = site
+	}
+	checkCard := func(draft uuid.UUID) string {
+		card := &Card{}
+		card.Id, card.Draft = uuid.New(), draft
+		invalid, err := checkRecords[Card](db, cards, 1, map[string]*Card{card.Id.String(): card})
+		require.NoError(t, err)
+		return invalid[card.Id.String()]
+	}
+
+	t.Run("Live reference of the site is accepted", func(t *testing.T) {
+		assert.Empty(t, checkCard(insert(TiptapV2_Table, SiteFlomo, false)))
+	})
+
+	t.Run("Deleted reference is refused", func(t *testing.T) {
+		draft := insert(TiptapV2_Table, SiteFlomo, true)
+		assert.Equal(t, "draft "+draft.String()+" does not exist", checkCard(draft))
+	})
+
+	t.Run("Reference to a row of another site is refused", func(t *testing.T) {
+		draft := insert(TiptapV2_Table, SiteJournal, false)
+		assert.Equal(t, "draft "+draft.String()+" does not exist", checkCard(draft))
+	})
+
+	t.Run("Reference to a row deleted by the same push is refused", func(t *testing.T) {
+		deleted := true
+		parent := &Folder{}
+		parent.Id, parent.IsDeleted = insert(Folder_Table, 0, false), &deleted
+		child := &Folder{}
+		child.Id, child.ParentId = uuid.New(), parent.Id
+		invalid, err := checkRecords[Folder](db, folders, 1, map[string]*Folder{
+			parent.Id.String(): parent,
+			child.Id.String():  child,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{child.Id.String(): "parentId " + parent.Id.String() + " does not exist"}, invalid)
+	})
+}
@@ -30,6 +30,12 @@ func (w *WatchV2) TableName() string {
 	return WatchV2_Table
 }
 
+func (w *WatchV2) check(c *PushCheck) {
+	c.Enum("type", w.Type, "Movie", "Series", "Documentary", "Book", "Game", "Manga")
+	// To Watch is the column default of rows created before Plan to Watch
+	c.Enum("status", w.Status, "Watching", "Completed", "Dropped", "Plan to Watch", "To Watch")
+}
+
 func (w *WatchV2) Get(db *gorm.DB, where map[string]any) error {
 	rst := db.Where(where).Find(&w)
 	if rst.Error != nil {
@@ -41,43 +47,10 @@ func (w *WatchV2) Get(db *gorm.DB, where map[string]any) error {
 	return nil
 }
 
-func ListWatchV2Since(db *gorm.DB, since int64, creatorId uint) ([]WatchV2, error) {
-	var objs []WatchV2
-	whereExpr := WhereExpr{}
-	whereExpr.GT(ServerVersion, since)
-	whereExpr.Eq(CreatorId, creatorId)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
-func FullWatchV2(db *gorm.DB, creatorId uint) ([]WatchV2, error) {
-	var objs []WatchV2
-	whereExpr := WhereExpr{}
-	whereExpr.Eq(CreatorId, creatorId)
-	whereExpr.Eq(IsDeleted, false)
-	for i := range whereExpr {
-		db = db.Where(whereExpr[i])
-	}
-	if err := db.Find(&objs).Error; err != nil {
-		return nil, err
-	}
-	return objs, nil
-}
-
 func (w *WatchV2) Create(db *gorm.DB) error {
 	return db.Create(w).Error
 }
 
-func (w *WatchV2) SyncFromClient(db *gorm.DB, where map[string]any) error {
-	syncDb := OmitMetaFields(db)
-	return syncDb.Where(where).UpdateColumns(w).Error
-}
-
 func (w *WatchV2) MarkDeleted(db *gorm.DB, where map[string]any) error {
 	return db.Model(w).Where(where).Update(IsDeleted, true).Error
 }
@@ -13,7 +13,9 @@ import (
 	"github.com/EricWvi/dashboard/handler/dashboard"
 	"github.com/EricWvi/dashboard/handler/echo"
 	"github.com/EricWvi/dashboard/handler/entry"
+	"github.com/EricWvi/dashboard/handler/events"
 	"github.com/EricWvi/dashboard/handler/flomo"
+	"github.com/EricWvi/dashboard/handler/fullsync"
 	"github.com/EricWvi/dashboard/handler/journal"
 	"github.com/EricWvi/dashboard/handler/media"
 	"github.com/EricWvi/dashboard/handler/tiptap"
@@ -35,7 +37,8 @@ func Load(g *gin.Engine, mw ...gin.HandlerFunc) *gin.Engine {
 	g.Use(gin.Recovery())
 	g.Use(middleware.CORSMiddleware())
 	g.Use(mw...)
-	g.Use(gzip.Gzip(gzip.DefaultCompression))
+	g.Use(gzip.Gzip(gzip.DefaultCompression,
+		gzip.WithExcludedPaths([]string{viper.GetString("route.back.base") + "/events"})))
 
 	// serve front dist
 	dir := viper.GetString("route.front.dir")
@@ -76,24 +79,26 @@ func Load(g *gin.Engine, mw ...gin.HandlerFunc) *gin.Engine {
 	g.StaticFile("/journal/", viper.GetString("route.journal.index"))
 
 	g.GET("/ping", handler.Ping)
+	// events and full syncs are streamed and must not be buffered by middleware.BodyWriter
+	g.GET(viper.GetString("route.back.base")+"/events", middleware.EventsJWT(), events.Stream)
+	g.GET(viper.GetString("route.back.base")+"/fullsync", middleware.JWT(), fullsync.Stream)
 	// middleware.BodyWriter retrieves response body
 	g.Use(middleware.BodyWriter())
 	// middleware.JWT inject user ID
 	g.Use(middleware.JWT())
-	// middleware.Idempotency handles idempotency key
-	// g.Use(middleware.Idempotency())
 
 	raw := g.Group(viper.GetString("route.back.base"))
 	raw.POST("/upload", media.Upload)
 	raw.GET("/m/:link", media.Serve)
 
 	back := g.Group(viper.GetString("route.back.base"))
+	// middleware.Idempotency replays POST requests retried with an Idempotency-Key
+	back.Use(middleware.Idempotency(middleware.PostgresIdempotency{}))
 	// middleware.Logging logs request and response
 	back.Use(middleware.Logging())
-	// middleware.Session maintains session status
-	// back.Use(middleware.Session())
 
 	back.GET("/auth", auth.DefaultHandler)
+	back.POST("/auth", auth.DefaultHandler)
 	back.GET("/user", user.DefaultHandler)
 	back.POST("/user", user.DefaultHandler)
 	back.GET("/media", media.DefaultHandler)
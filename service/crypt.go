@@ -5,11 +5,15 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
 )
 
+// Key is the legacy encryption key, see Keyring.
 func Key() string {
 	return os.Getenv("DASHBOARD_ENCRYPT_KEY")
 }
@@ -65,3 +69,125 @@ func Decrypt(key, blob string) (string, error) {
 		return string(plaintext), nil
 	}
 }
+
+// Keyring encrypts with its current key and decrypts with any of its keys.
+// Ciphertexts start with the id of their key, "<id>:<blob>", so that keys can
+// be rotated without losing what the previous ones encrypted. Ciphertexts
+// written before keys had ids are decrypted with the legacy key.
+type Keyring struct {
+	keys    map[string]string
+	current string
+	legacy  string
+}
+
+// NewKeyring parses keys, a comma separated list of <id>:<key> where the last
+// one is current. Ids are letters and digits. When keys is empty the legacy
+// key is the current key, under id 1.
+func NewKeyring(keys, legacy string) (*Keyring, error) {
+	ring := &Keyring{keys: make(map[string]string), legacy: legacy}
+	if keys == "" {
+		if legacy == "" {
+			return nil, errors.New("no encryption key is set")
+		}
+		keys = "1:" + legacy
+	}
+	for i, entry := range strings.Split(keys, ",") {
+		id, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || !validKeyId(id) {
+			// the entry is not quoted, it may well be a key
+			return nil, fmt.Errorf("encryption key entry %d is not <id>:<key>", i+1)
+		}
+		if _, err := aes.NewCipher([]byte(key)); err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		if _, ok := ring.keys[id]; ok {
+			return nil, fmt.Errorf("encryption key %s is listed twice", id)
+		}
+		ring.keys[id] = key
+		ring.current = id
+	}
+	return ring, nil
+}
+
+func validKeyId(id string) bool {
+	if id == "" || len(id) > 16 {
+		return false
+	}
+	for _, r := range id {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	keyring   *Keyring
+	keyringMu sync.Mutex
+)
+
+// Keys returns the keyring of DASHBOARD_ENCRYPT_KEYS, DASHBOARD_ENCRYPT_KEY
+// being the legacy key, see NewKeyring.
+func Keys() (*Keyring, error) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	if keyring != nil {
+		return keyring, nil
+	}
+	ring, err := NewKeyring(os.Getenv("DASHBOARD_ENCRYPT_KEYS"), Key())
+	if err != nil {
+		return nil, err
+	}
+	keyring = ring
+	return ring, nil
+}
+
+// CurrentKey is the id of the key new ciphertexts are encrypted with.
+func (k *Keyring) CurrentKey() string {
+	return k.current
+}
+
+// Encrypt encrypts plaintext with the current key.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	blob, err := Encrypt(k.keys[k.current], plaintext)
+	if err != nil {
+		return "", err
+	}
+	return k.current + ":" + blob, nil
+}
+
+// Decrypt decrypts a ciphertext of any key of the ring.
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
+	id, blob, ok := strings.Cut(ciphertext, ":")
+	if !ok {
+		if k.legacy == "" {
+			return "", errors.New("ciphertext has no key id and no legacy key is set")
+		}
+		return Decrypt(k.legacy, ciphertext)
+	}
+	key, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("encryption key %s is not in the keyring", id)
+	}
+	return Decrypt(key, blob)
+}
+
+// IsCurrent tells whether ciphertext is encrypted with the current key.
+func (k *Keyring) IsCurrent(ciphertext string) bool {
+	id, _, ok := strings.Cut(ciphertext, ":")
+	return ok && id == k.current
+}
+
+// Reencrypt returns ciphertext encrypted with the current key, and whether it
+// was not already.
+func (k *Keyring) Reencrypt(ciphertext string) (string, bool, error) {
+	if ciphertext == "" || k.IsCurrent(ciphertext) {
+		return ciphertext, false, nil
+	}
+	plaintext, err := k.Decrypt(ciphertext)
+	if err != nil {
+		return "", false, err
+	}
+	rotated, err := k.Encrypt(plaintext)
+	return rotated, err == nil, err
+}
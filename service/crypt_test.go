@@ -0,0 +1,115 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	oldKey = "0123456789abcdef0123456789abcdef"
+	newKey = "fedcba9876543210fedcba9876543210"
+)
+
+func TestKeyring(t *testing.T) {
+	t.Run("Encrypts with the last key", func(t *testing.T) {
+		ring, err := NewKeyring("1:"+oldKey+",2:"+newKey, "")
+		require.NoError(t, err)
+		assert.Equal(t, "2", ring.CurrentKey())
+
+		ciphertext, err := ring.Encrypt("secret")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(ciphertext, "2:"))
+		assert.True(t, ring.IsCurrent(ciphertext))
+
+		plaintext, err := ring.Decrypt(ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", plaintext)
+	})
+
+	t.Run("Decrypts with previous keys", func(t *testing.T) {
+		old, err := NewKeyring("1:"+oldKey, "")
+		require.NoError(t, err)
+		ciphertext, err := old.Encrypt("secret")
+		require.NoError(t, err)
+
+		ring, err := NewKeyring("1:"+oldKey+",2:"+newKey, "")
+		require.NoError(t, err)
+		assert.False(t, ring.IsCurrent(ciphertext))
+		plaintext, err := ring.Decrypt(ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", plaintext)
+	})
+
+	t.Run("Decrypts ciphertexts without key id with the legacy key", func(t *testing.T) {
+		ciphertext, err := Encrypt(oldKey, "secret")
+		require.NoError(t, err)
+
+		ring, err := NewKeyring("2:"+newKey, oldKey)
+		require.NoError(t, err)
+		plaintext, err := ring.Decrypt(ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", plaintext)
+
+		ring, err = NewKeyring("2:"+newKey, "")
+		require.NoError(t, err)
+		_, err = ring.Decrypt(ciphertext)
+		assert.Error(t, err)
+	})
+
+	t.Run("Legacy key alone is key 1", func(t *testing.T) {
+		ring, err := NewKeyring("", oldKey)
+		require.NoError(t, err)
+		assert.Equal(t, "1", ring.CurrentKey())
+	})
+
+	t.Run("Retired key is refused", func(t *testing.T) {
+		old, err := NewKeyring("1:"+oldKey, "")
+		require.NoError(t, err)
+		ciphertext, err := old.Encrypt("secret")
+		require.NoError(t, err)
+
+		ring, err := NewKeyring("2:"+newKey, "")
+		require.NoError(t, err)
+		_, err = ring.Decrypt(ciphertext)
+		assert.ErrorContains(t, err, "not in the keyring")
+	})
+
+	t.Run("Reencrypt moves ciphertexts to the current key", func(t *testing.T) {
+		legacy, err := Encrypt(oldKey, "secret")
+		require.NoError(t, err)
+		ring, err := NewKeyring("1:"+oldKey+",2:"+newKey, oldKey)
+		require.NoError(t, err)
+
+		rotated, changed, err := ring.Reencrypt(legacy)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.True(t, ring.IsCurrent(rotated))
+
+		again, changed, err := ring.Reencrypt(rotated)
+		require.NoError(t, err)
+		assert.False(t, changed)
+		assert.Equal(t, rotated, again)
+
+		empty, changed, err := ring.Reencrypt("")
+		require.NoError(t, err)
+		assert.False(t, changed)
+		assert.Empty(t, empty)
+	})
+
+	t.Run("Invalid keyrings are refused", func(t *testing.T) {
+		for _, keys := range []string{
+			oldKey,
+			"1:short",
+			"a-b:" + oldKey,
+			"1:" + oldKey + ",1:" + newKey,
+		} {
+			_, err := NewKeyring(keys, "")
+			assert.Error(t, err, keys)
+		}
+		_, err := NewKeyring("", "")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/EricWvi/dashboard/log"
+	"github.com/jackc/pgx/v5"
+)
+
+// SyncChannel is the channel global_bump_server_version() notifies on.
+const SyncChannel = "sync_changes"
+
+// SyncChange tells that rows of Table owned by User got a new server_version.
+// Scope is the tag group for d_tag_v2 and the site for d_tiptap_v2.
+// An empty Table means changes may have been missed and everything should be pulled.
+type SyncChange struct {
+	User  uint   `json:"user"`
+	Table string `json:"table"`
+	Scope string `json:"scope"`
+}
+
+var syncHub = struct {
+	sync.RWMutex
+	subs   map[uint]map[chan SyncChange]struct{}
+	closed bool
+}{subs: make(map[uint]map[chan SyncChange]struct{})}
+
+// SubscribeSyncChanges registers a listener for the changes of userId.
+// The returned func must be called to unsubscribe. The channel is closed
+// when the server shuts down.
+func SubscribeSyncChanges(userId uint) (<-chan SyncChange, func()) {
+	ch := make(chan SyncChange, 64)
+	syncHub.Lock()
+	if syncHub.closed {
+		syncHub.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if syncHub.subs[userId] == nil {
+		syncHub.subs[userId] = make(map[chan SyncChange]struct{})
+	}
+	syncHub.subs[userId][ch] = struct{}{}
+	syncHub.Unlock()
+
+	return ch, func() {
+		syncHub.Lock()
+		delete(syncHub.subs[userId], ch)
+		if len(syncHub.subs[userId]) == 0 {
+			delete(syncHub.subs, userId)
+		}
+		syncHub.Unlock()
+	}
+}
+
+// CloseSyncSubscribers closes every subscription so that long-lived
+// connections end when the server shuts down.
+func CloseSyncSubscribers() {
+	syncHub.Lock()
+	defer syncHub.Unlock()
+	for _, subs := range syncHub.subs {
+		for ch := range subs {
+			close(ch)
+		}
+	}
+	syncHub.subs = make(map[uint]map[chan SyncChange]struct{})
+	syncHub.closed = true
+}
+
+func publishSyncChange(change SyncChange) {
+	syncHub.RLock()
+	defer syncHub.RUnlock()
+	for ch := range syncHub.subs[change.User] {
+		select {
+		case ch <- change:
+		default:
+			// the subscriber is behind and will pull anyway
+		}
+	}
+}
+
+func publishResync() {
+	syncHub.RLock()
+	defer syncHub.RUnlock()
+	for userId, subs := range syncHub.subs {
+		for ch := range subs {
+			select {
+			case ch <- SyncChange{User: userId}:
+			default:
+			}
+		}
+	}
+}
+
+// StartSyncNotifyWorker listens for sync changes on a dedicated connection
+// and fans them out to the subscribers, reconnecting when the connection drops.
+func StartSyncNotifyWorker(dsn string) {
+	WorkerWg.Add(1)
+	go func() {
+		defer WorkerWg.Done()
+		connected := false
+		for {
+			err := listenSyncChanges(dsn, func() {
+				// notifications sent while disconnected are lost
+				if connected {
+					publishResync()
+				}
+				connected = true
+			})
+			if workerCtx.Err() != nil {
+				log.Info(log.WorkerCtx, "Sync notify worker stopped")
+				return
+			}
+			log.Errorf(log.WorkerCtx, "Sync notify listener failed, reconnecting: %v", err)
+			select {
+			case <-workerCtx.Done():
+				log.Info(log.WorkerCtx, "Sync notify worker stopped")
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+}
+
+func listenSyncChanges(dsn string, onListen func()) error {
+	conn, err := pgx.Connect(workerCtx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(workerCtx, "LISTEN "+SyncChannel); err != nil {
+		return err
+	}
+	log.Info(log.WorkerCtx, "Sync notify worker listening")
+	onListen()
+
+	for {
+		n, err := conn.WaitForNotification(workerCtx)
+		if err != nil {
+			return err
+		}
+		var change SyncChange
+		if err := json.Unmarshal([]byte(n.Payload), &change); err != nil {
+			log.Errorf(log.WorkerCtx, "Invalid sync notification %q: %v", n.Payload, err)
+			continue
+		}
+		publishSyncChange(change)
+	}
+}
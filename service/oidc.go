@@ -1,90 +1,232 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
 )
 
-type TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
-	IDToken     string `json:"id_token"`
+var ErrEmailNotVerified = errors.New("email is not verified by the identity provider")
+
+// OIDCProvider signs users in with the authorization code flow of an OpenID
+// Connect issuer, configured from its discovery document. The signing keys of
+// the issuer are cached and refreshed when an unknown key shows up.
+type OIDCProvider struct {
+	// Name is the key of the provider in oidc.providers
+	Name string
+	// LinkByEmail is OIDCProviderConfig.LinkByEmail
+	LinkByEmail bool
+
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	config   oauth2.Config
 }
 
-// exchangeCodeForToken exchanges the authorization code for an access token
-func ExchangeCodeForToken(tokenEndpoint, code, clientID, clientSecret, redirectURI string) (*TokenResponse, error) {
-	data := url.Values{}
-	data.Set("grant_type", "authorization_code")
-	data.Set("code", code)
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
-	data.Set("redirect_uri", redirectURI)
+// OIDCIdentity is the user an ID token was issued for.
+type OIDCIdentity struct {
+	Issuer  string
+	Subject string
+	Email   string
+	Name    string
+}
+
+// idTokenClaims are the claims read from ID tokens and userinfo responses
+type idTokenClaims struct {
+	Email             string `json:"email"`
+	EmailVerified     *bool  `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+}
 
-	req, err := http.NewRequest("POST", tokenEndpoint, bytes.NewBufferString(data.Encode()))
+// NewOIDCProvider loads the discovery document of issuer. ctx carries the http
+// client used for the issuer, see oidc.ClientContext.
+func NewOIDCProvider(ctx context.Context, issuer, clientID, clientSecret string, scopes []string) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create token request: %w", err)
+		return nil, fmt.Errorf("failed to discover %s: %w", issuer, err)
 	}
+	if !slices.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+	return &OIDCProvider{
+		provider: provider,
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+	}, nil
+}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+// OIDCProviderConfig is a provider of oidc.providers. Its client secret is
+// read from the ClientSecretEnv environment variable, by default
+// DASHBOARD_OIDC_<NAME>_CLIENT_SECRET.
+type OIDCProviderConfig struct {
+	// DisplayName is shown on the login button
+	DisplayName     string
+	Issuer          string
+	ClientId        string
+	ClientSecretEnv string
+	Scopes          []string
+	// LinkByEmail signs in the user with the email of an identity not linked
+	// yet, for providers trusted to verify emails
+	LinkByEmail bool
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send token request: %w", err)
+var (
+	oidcProviders = make(map[string]*OIDCProvider)
+	oidcMu        sync.Mutex
+)
+
+// OIDCProviderConfigs returns oidc.providers by name. Names are lower case.
+func OIDCProviderConfigs() (map[string]OIDCProviderConfig, error) {
+	configs := make(map[string]OIDCProviderConfig)
+	if err := viper.UnmarshalKey("oidc.providers", &configs); err != nil {
+		return nil, fmt.Errorf("failed to read oidc.providers: %w", err)
 	}
-	defer resp.Body.Close()
+	return configs, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, string(body))
+// DefaultOIDCProvider is the provider of logins not naming one,
+// oidc.defaultProvider or the only provider configured.
+func DefaultOIDCProvider() string {
+	if name := viper.GetString("oidc.defaultProvider"); name != "" {
+		return strings.ToLower(name)
 	}
+	configs, err := OIDCProviderConfigs()
+	if err != nil || len(configs) != 1 {
+		return ""
+	}
+	for name := range configs {
+		return name
+	}
+	return ""
+}
 
-	var tokenResp TokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return nil, fmt.Errorf("failed to decode token response: %w", err)
+// OIDC returns the provider name of oidc.providers, discovered on first use.
+// A failed discovery is retried by the next call.
+func OIDC(name string) (*OIDCProvider, error) {
+	name = strings.ToLower(name)
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if provider, ok := oidcProviders[name]; ok {
+		return provider, nil
 	}
 
-	return &tokenResp, nil
+	configs, err := OIDCProviderConfigs()
+	if err != nil {
+		return nil, err
+	}
+	config, ok := configs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown OIDC provider %q", name)
+	}
+	secretEnv := config.ClientSecretEnv
+	if secretEnv == "" {
+		secretEnv = "DASHBOARD_OIDC_" + strings.ToUpper(name) + "_CLIENT_SECRET"
+	}
+	clientSecret := os.Getenv(secretEnv)
+	if config.Issuer == "" || config.ClientId == "" || clientSecret == "" {
+		return nil, fmt.Errorf("OIDC provider %s is not properly configured", name)
+	}
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	provider, err := NewOIDCProvider(context.Background(), config.Issuer, config.ClientId, clientSecret, scopes)
+	if err != nil {
+		return nil, err
+	}
+	provider.Name = name
+	provider.LinkByEmail = config.LinkByEmail
+	oidcProviders[name] = provider
+	return provider, nil
 }
 
-type UserInfoResponse struct {
-	Sub               string `json:"sub"`
-	Email             string `json:"email"`
-	EmailVerified     bool   `json:"email_verified"`
-	Name              string `json:"name"`
-	PreferredUsername string `json:"preferred_username"`
+// AuthCodeURL returns the authorization URL of a login. The issuer sends state
+// back along with the code and puts nonce in the ID token. The code is only
+// redeemed along with verifier, see oauth2.GenerateVerifier.
+func (p *OIDCProvider) AuthCodeURL(redirectURI, state, nonce, verifier string) string {
+	config := p.config
+	config.RedirectURL = redirectURI
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
 }
 
-// getUserInfo retrieves user information from the userinfo endpoint
-func GetUserInfo(userinfoEndpoint, accessToken string) (*UserInfoResponse, error) {
-	req, err := http.NewRequest("GET", userinfoEndpoint, nil)
+// Exchange redeems the code of a login started by AuthCodeURL and returns the
+// identity of its ID token, once its signature, issuer, audience, expiry and
+// nonce are checked. Claims missing from the ID token are read from userinfo.
+// Identities without a verified email are refused with ErrEmailNotVerified.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, redirectURI, nonce, verifier string) (*OIDCIdentity, error) {
+	config := p.config
+	config.RedirectURL = redirectURI
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create userinfo request: %w", err)
+		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
 	}
-
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send userinfo request: %w", err)
+		return nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce does not match the login")
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("userinfo endpoint returned status %d: %s", resp.StatusCode, string(body))
+	claims := idTokenClaims{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode id_token claims: %w", err)
+	}
+	if claims.Email == "" || claims.EmailVerified == nil {
+		userInfo, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user info: %w", err)
+		}
+		if userInfo.Subject != idToken.Subject {
+			return nil, errors.New("userinfo subject does not match the id_token")
+		}
+		if err := userInfo.Claims(&claims); err != nil {
+			return nil, fmt.Errorf("failed to decode user info: %w", err)
+		}
+	}
+	if claims.Email == "" {
+		return nil, errors.New("identity provider returned no email")
+	}
+	if claims.EmailVerified == nil || !*claims.EmailVerified {
+		return nil, ErrEmailNotVerified
 	}
 
-	var userInfo UserInfoResponse
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		return nil, fmt.Errorf("failed to decode userinfo response: %w", err)
+	name := claims.Name
+	if name == "" {
+		name = claims.PreferredUsername
 	}
+	return &OIDCIdentity{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+		Email:   claims.Email,
+		Name:    name,
+	}, nil
+}
 
-	return &userInfo, nil
+// RandomString returns n random bytes encoded in base64url, for state and nonce.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+const (
+	stubClientID    = "dashboard-test"
+	stubRedirectURI = "https://dashboard.test/callback"
+	stubCode        = "stub-code"
+	stubKeyId       = "stub-key"
+)
+
+// stubIssuer is an OpenID Connect issuer serving a single login
+type stubIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	// claims of the next ID token, iss, aud, exp and iat are filled in when missing
+	claims jwt.MapClaims
+	// signer overrides the key signing the next ID token
+	signer   *rsa.PrivateKey
+	userInfo map[string]any
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	s := &stubIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                s.URL,
+			"authorization_endpoint":                s.URL + "/authorize",
+			"token_endpoint":                        s.URL + "/token",
+			"userinfo_endpoint":                     s.URL + "/userinfo",
+			"jwks_uri":                              s.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]any{{
+			"kty": "RSA",
+			"kid": stubKeyId,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != stubCode || base64.RawURLEncoding.EncodeToString(sum[:]) != s.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "stub-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     s.idToken(t),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer stub-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.userInfo)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubIssuer) idToken(t *testing.T) string {
+	claims := jwt.MapClaims{
+		"iss": s.URL,
+		"aud": stubClientID,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+	for k, v := range s.claims {
+		claims[k] = v
+	}
+	signer := s.key
+	if s.signer != nil {
+		signer = s.signer
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = stubKeyId
+	signed, err := token.SignedString(signer)
+	require.NoError(t, err)
+	return signed
+}
+
+// login starts a login and returns its nonce and verifier, as the issuer
+// would see the user coming back
+func (s *stubIssuer) login(t *testing.T, provider *OIDCProvider) (string, string) {
+	nonce, err := RandomString(16)
+	require.NoError(t, err)
+	verifier := oauth2.GenerateVerifier()
+
+	authURL, err := url.Parse(provider.AuthCodeURL(stubRedirectURI, "stub-state", nonce, verifier))
+	require.NoError(t, err)
+	query := authURL.Query()
+	assert.True(t, strings.HasPrefix(authURL.String(), s.URL+"/authorize"))
+	assert.Equal(t, "stub-state", query.Get("state"))
+	assert.Equal(t, nonce, query.Get("nonce"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Contains(t, query.Get("scope"), "openid")
+	s.challenge = query.Get("code_challenge")
+	return nonce, verifier
+}
+
+func TestOIDCProvider(t *testing.T) {
+	ctx := context.Background()
+	issuer := newStubIssuer(t)
+	provider, err := NewOIDCProvider(ctx, issuer.URL, stubClientID, "stub-secret", []string{"email"})
+	require.NoError(t, err)
+
+	t.Run("Verified email in the ID token signs in", func(t *testing.T) {
+		nonce, verifier := issuer.login(t, provider)
+		issuer.claims = jwt.MapClaims{"sub": "alice", "nonce": nonce, "email": "alice@example.com", "email_verified": true}
+
+		identity, err := provider.Exchange(ctx, stubCode, stubRedirectURI, nonce, verifier)
+		require.NoError(t, err)
+		assert.Equal(t, issuer.URL, identity.Issuer)
+		assert.Equal(t, "alice", identity.Subject)
+		assert.Equal(t, "alice@example.com", identity.Email)
+	})
+
+	t.Run("Code is not redeemed without its verifier", func(t *testing.T) {
+		nonce, _ := issuer.login(t, provider)
+		issuer.claims = jwt.MapClaims{"sub": "alice", "nonce": nonce, "email": "alice@example.com", "email_verified": true}
+
+		_, err := provider.Exchange(ctx, stubCode, stubRedirectURI, nonce, oauth2.GenerateVerifier())
+		assert.Error(t, err)
+	})
+
+	t.Run("ID token of another login is refused", func(t *testing.T) {
+		nonce, verifier := issuer.login(t, provider)
+		issuer.claims = jwt.MapClaims{"sub": "alice", "nonce": "another-nonce", "email": "alice@example.com", "email_verified": true}
+
+		_, err := provider.Exchange(ctx, stubCode, stubRedirectURI, nonce, verifier)
+		assert.ErrorContains(t, err, "nonce")
+	})
+
+	t.Run("ID token for another client is refused", func(t *testing.T) {
+		nonce, verifier := issuer.login(t, provider)
+		issuer.claims = jwt.MapClaims{"sub": "alice", "nonce": nonce, "aud": "another-client",
+			"email": "alice@example.com", "email_verified": true}
+
+		_, err := provider.Exchange(ctx, stubCode, stubRedirectURI, nonce, verifier)
+		assert.Error(t, err)
+	})
+
+	t.Run("ID token from another issuer is refused", func(t *testing.T) {
+		nonce, verifier := issuer.login(t, provider)
+		issuer.claims = jwt.MapClaims{"sub": "alice", "nonce": nonce, "iss": "https://evil.example.com",
+			"email": "alice@example.com", "email_verified": true}
+
+		_, err := provider.Exchange(ctx, stubCode, stubRedirectURI, nonce, verifier)
+		assert.Error(t, err)
+	})
+
+	t.Run("ID token signed by an unknown key is refused", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		issuer.signer = other
+		defer func() { issuer.signer = nil }()
+		nonce, verifier := issuer.login(t, provider)
+		issuer.claims = jwt.MapClaims{"sub": "alice", "nonce": nonce, "email": "alice@example.com", "email_verified": true}
+
+		_, err = provider.Exchange(ctx, stubCode, stubRedirectURI, nonce, verifier)
+		assert.Error(t, err)
+	})
+
+	t.Run("Unverified email is refused", func(t *testing.T) {
+		nonce, verifier := issuer.login(t, provider)
+		issuer.claims = jwt.MapClaims{"sub": "alice", "nonce": nonce, "email": "alice@example.com", "email_verified": false}
+
+		_, err := provider.Exchange(ctx, stubCode, stubRedirectURI, nonce, verifier)
+		assert.ErrorIs(t, err, ErrEmailNotVerified)
+	})
+
+	t.Run("Email missing from the ID token is read from userinfo", func(t *testing.T) {
+		nonce, verifier := issuer.login(t, provider)
+		issuer.claims = jwt.MapClaims{"sub": "bob", "nonce": nonce}
+		issuer.userInfo = map[string]any{"sub": "bob", "email": "bob@example.com", "email_verified": true, "name": "Bob"}
+
+		identity, err := provider.Exchange(ctx, stubCode, stubRedirectURI, nonce, verifier)
+		require.NoError(t, err)
+		assert.Equal(t, "bob@example.com", identity.Email)
+		assert.Equal(t, "Bob", identity.Name)
+	})
+
+	t.Run("Userinfo of another subject is refused", func(t *testing.T) {
+		nonce, verifier := issuer.login(t, provider)
+		issuer.claims = jwt.MapClaims{"sub": "bob", "nonce": nonce}
+		issuer.userInfo = map[string]any{"sub": "mallory", "email": "mallory@example.com", "email_verified": true}
+
+		_, err := provider.Exchange(ctx, stubCode, stubRedirectURI, nonce, verifier)
+		assert.ErrorContains(t, err, "subject")
+	})
+}
+
+func TestOIDCProviderConfigs(t *testing.T) {
+	viper.SetConfigType("yaml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader(`
+oidc:
+  providers:
+    SelfHosted:
+      displayName: "Self hosted"
+      issuer: "https://auth.example.com"
+      clientId: "dashboard"
+      clientSecretEnv: DASHBOARD_CLIENT_SECRET
+      linkByEmail: true
+    google:
+      issuer: "https://accounts.google.com"
+      clientId: "dashboard.apps.googleusercontent.com"
+`)))
+	t.Cleanup(viper.Reset)
+
+	configs, err := OIDCProviderConfigs()
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	assert.Equal(t, OIDCProviderConfig{
+		DisplayName:     "Self hosted",
+		Issuer:          "https://auth.example.com",
+		ClientId:        "dashboard",
+		ClientSecretEnv: "DASHBOARD_CLIENT_SECRET",
+		LinkByEmail:     true,
+	}, configs["selfhosted"])
+	assert.False(t, configs["google"].LinkByEmail)
+
+	// several providers need a default
+	assert.Empty(t, DefaultOIDCProvider())
+	viper.Set("oidc.defaultProvider", "SelfHosted")
+	assert.Equal(t, "selfhosted", DefaultOIDCProvider())
+
+	_, err = OIDC("unknown")
+	assert.ErrorContains(t, err, "unknown OIDC provider")
+	_, err = OIDC("google")
+	assert.ErrorContains(t, err, "not properly configured")
+}
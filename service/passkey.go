@@ -0,0 +1,152 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/spf13/viper"
+)
+
+var ErrPasskeyCloned = errors.New("passkey signature counter went backwards, it may be cloned")
+
+// PasskeyUser is a user signing in with passkeys. Handle is the random user
+// handle their passkeys were registered for, it is what discoverable
+// credentials give back to find the user.
+type PasskeyUser struct {
+	Id          uint
+	Handle      []byte
+	Name        string
+	Credentials []webauthn.Credential
+}
+
+func (u *PasskeyUser) WebAuthnID() []byte {
+	return u.Handle
+}
+
+func (u *PasskeyUser) WebAuthnName() string {
+	return u.Name
+}
+
+func (u *PasskeyUser) WebAuthnDisplayName() string {
+	return u.Name
+}
+
+func (u *PasskeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
+
+// Passkeys runs the WebAuthn ceremonies of the relying party. Passkeys are
+// registered as discoverable credentials, so that signing in does not ask for
+// a user name first.
+type Passkeys struct {
+	webauthn *webauthn.WebAuthn
+}
+
+// NewPasskeys configures the relying party rpID, the domain passkeys are bound
+// to, served from origins.
+func NewPasskeys(rpID, rpDisplayName string, origins []string) (*Passkeys, error) {
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpDisplayName,
+		RPOrigins:     origins,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationPreferred,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Passkeys{webauthn: wa}, nil
+}
+
+var (
+	passkeys   *Passkeys
+	passkeysMu sync.Mutex
+)
+
+// WebAuthn returns the relying party of passkey.rpId.
+func WebAuthn() (*Passkeys, error) {
+	passkeysMu.Lock()
+	defer passkeysMu.Unlock()
+	if passkeys != nil {
+		return passkeys, nil
+	}
+
+	rpID := viper.GetString("passkey.rpId")
+	origins := viper.GetStringSlice("passkey.origins")
+	if rpID == "" || len(origins) == 0 {
+		return nil, errors.New("passkeys are not properly configured")
+	}
+	p, err := NewPasskeys(rpID, viper.GetString("passkey.rpDisplayName"), origins)
+	if err != nil {
+		return nil, err
+	}
+	passkeys = p
+	return p, nil
+}
+
+// NewPasskeyHandle returns a random user handle.
+func NewPasskeyHandle() ([]byte, error) {
+	handle := make([]byte, 32)
+	if _, err := rand.Read(handle); err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+// BeginRegistration returns the options the client creates a passkey of user
+// with, and the session to complete it with. The passkeys user already has
+// are excluded.
+func (p *Passkeys) BeginRegistration(user *PasskeyUser) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	return p.webauthn.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.Credentials).CredentialDescriptors()))
+}
+
+// FinishRegistration verifies the credential the client created, its JSON
+// encoded PublicKeyCredential, and returns it to be stored.
+func (p *Passkeys) FinishRegistration(user *PasskeyUser, session webauthn.SessionData, response []byte) (*webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse credential: %w", err)
+	}
+	credential, err := p.webauthn.CreateCredential(user, session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify credential: %w", err)
+	}
+	return credential, nil
+}
+
+// BeginLogin returns the options the client asserts any passkey of the relying
+// party with, and the session to complete it with.
+func (p *Passkeys) BeginLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return p.webauthn.BeginDiscoverableLogin()
+}
+
+// FinishLogin verifies the assertion of the client, its JSON encoded
+// PublicKeyCredential. lookup finds the user a credential was registered for.
+// It returns the user along with the credential, updated with its signature
+// counter to be stored.
+func (p *Passkeys) FinishLogin(session webauthn.SessionData, response []byte, lookup func(credentialId, handle []byte) (*PasskeyUser, error)) (*PasskeyUser, *webauthn.Credential, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse assertion: %w", err)
+	}
+	var found *PasskeyUser
+	_, credential, err := p.webauthn.ValidatePasskeyLogin(func(rawID, handle []byte) (webauthn.User, error) {
+		user, err := lookup(rawID, handle)
+		found = user
+		return user, err
+	}, session, parsed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to verify assertion: %w", err)
+	}
+	if credential.Authenticator.CloneWarning {
+		return nil, nil, ErrPasskeyCloned
+	}
+	return found, credential, nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/EricWvi/dashboard/service/passkeytest"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRPID   = "dashboard.test"
+	testOrigin = "https://dashboard.test"
+)
+
+func TestPasskeys(t *testing.T) {
+	passkeys, err := NewPasskeys(testRPID, "Dashboard", []string{testOrigin})
+	require.NoError(t, err)
+
+	handle, err := NewPasskeyHandle()
+	require.NoError(t, err)
+	user := &PasskeyUser{Id: 7, Handle: handle, Name: "alice@example.com"}
+	authenticator := passkeytest.New(t, testOrigin)
+
+	register := func(t *testing.T, a *passkeytest.Authenticator) (*webauthn.Credential, error) {
+		creation, session, err := passkeys.BeginRegistration(user)
+		require.NoError(t, err)
+		assert.Equal(t, testRPID, creation.Response.RelyingParty.ID)
+		return passkeys.FinishRegistration(user, *session, a.Create(t, testRPID, creation.Response.Challenge.String(), handle))
+	}
+	lookup := func(credentialId, userHandle []byte) (*PasskeyUser, error) {
+		if !bytes.Equal(userHandle, user.Handle) {
+			return nil, errors.New("unknown user handle")
+		}
+		return user, nil
+	}
+	login := func(t *testing.T, a *passkeytest.Authenticator) (*PasskeyUser, *webauthn.Credential, error) {
+		assertion, session, err := passkeys.BeginLogin()
+		require.NoError(t, err)
+		return passkeys.FinishLogin(*session, a.Get(t, testRPID, assertion.Response.Challenge.String()), lookup)
+	}
+
+	t.Run("Registered passkey signs in", func(t *testing.T) {
+		credential, err := register(t, authenticator)
+		require.NoError(t, err)
+		assert.Equal(t, authenticator.CredentialId, credential.ID)
+		user.Credentials = []webauthn.Credential{*credential}
+
+		signedIn, credential, err := login(t, authenticator)
+		require.NoError(t, err)
+		assert.Equal(t, uint(7), signedIn.Id)
+		assert.Equal(t, uint32(1), credential.Authenticator.SignCount)
+		user.Credentials = []webauthn.Credential{*credential}
+	})
+
+	t.Run("Registration from another origin is refused", func(t *testing.T) {
+		other := passkeytest.New(t, testOrigin)
+		other.Origin = "https://evil.example.com"
+		_, err := register(t, other)
+		assert.Error(t, err)
+	})
+
+	t.Run("Registration answering another challenge is refused", func(t *testing.T) {
+		other := passkeytest.New(t, testOrigin)
+		_, session, err := passkeys.BeginRegistration(user)
+		require.NoError(t, err)
+		_, err = passkeys.FinishRegistration(user, *session, other.Create(t, testRPID, passkeytest.B64([]byte("another-challenge-0123456789")), handle))
+		assert.Error(t, err)
+	})
+
+	t.Run("Assertion for another relying party is refused", func(t *testing.T) {
+		assertion, session, err := passkeys.BeginLogin()
+		require.NoError(t, err)
+		_, _, err = passkeys.FinishLogin(*session, authenticator.Get(t, "evil.example.com", assertion.Response.Challenge.String()), lookup)
+		assert.Error(t, err)
+	})
+
+	t.Run("Assertion of an unknown passkey is refused", func(t *testing.T) {
+		stranger := passkeytest.New(t, testOrigin)
+		stranger.UserHandle = handle
+		_, _, err := login(t, stranger)
+		assert.Error(t, err)
+	})
+
+	t.Run("Assertion of an unknown user is refused", func(t *testing.T) {
+		stranger := passkeytest.New(t, testOrigin)
+		stranger.UserHandle = []byte("someone-else")
+		_, _, err := login(t, stranger)
+		assert.Error(t, err)
+	})
+
+	t.Run("Counter going backwards is refused as a clone", func(t *testing.T) {
+		clone := *authenticator
+		clone.SignCount = 0
+		_, _, err := login(t, &clone)
+		assert.ErrorIs(t, err, ErrPasskeyCloned)
+	})
+}
@@ -0,0 +1,123 @@
+// Package passkeytest answers passkey ceremonies the way a browser and its
+// authenticator would, for tests of the relying party.
+package passkeytest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/stretchr/testify/require"
+)
+
+// Authenticator is a passkey authenticator holding a single P-256 key in
+// memory. Origin is the origin the browser reports in its client data.
+type Authenticator struct {
+	Key          *ecdsa.PrivateKey
+	CredentialId []byte
+	UserHandle   []byte
+	SignCount    uint32
+	Origin       string
+}
+
+func New(t *testing.T, origin string) *Authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+	return &Authenticator{Key: key, CredentialId: id, Origin: origin}
+}
+
+// B64 encodes b the way WebAuthn encodes binary fields.
+func B64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (a *Authenticator) clientData(t *testing.T, ceremony, challenge string) []byte {
+	data, err := json.Marshal(map[string]any{"type": ceremony, "challenge": challenge, "origin": a.Origin})
+	require.NoError(t, err)
+	return data
+}
+
+// authData is the authenticator data of a ceremony, with the credential
+// attested when attested is set
+func (a *Authenticator) authData(t *testing.T, rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := bytes.NewBuffer(rpIDHash[:])
+	// user present and verified
+	flags := byte(0x01 | 0x04)
+	if attested {
+		flags |= 0x40
+	}
+	data.WriteByte(flags)
+	_ = binary.Write(data, binary.BigEndian, a.SignCount)
+	if attested {
+		data.Write(make([]byte, 16))
+		_ = binary.Write(data, binary.BigEndian, uint16(len(a.CredentialId)))
+		data.Write(a.CredentialId)
+		publicKey, err := webauthncbor.Marshal(map[int]any{
+			1:  2,  // EC2
+			3:  -7, // ES256
+			-1: 1,  // P-256
+			-2: a.Key.X.FillBytes(make([]byte, 32)),
+			-3: a.Key.Y.FillBytes(make([]byte, 32)),
+		})
+		require.NoError(t, err)
+		data.Write(publicKey)
+	}
+	return data.Bytes()
+}
+
+// Create answers navigator.credentials.create with a "none" attestation
+func (a *Authenticator) Create(t *testing.T, rpID, challenge string, userHandle []byte) []byte {
+	a.UserHandle = userHandle
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(t, rpID, true),
+	})
+	require.NoError(t, err)
+	response, err := json.Marshal(map[string]any{
+		"id":    B64(a.CredentialId),
+		"rawId": B64(a.CredentialId),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    B64(a.clientData(t, "webauthn.create", challenge)),
+			"attestationObject": B64(attestation),
+		},
+	})
+	require.NoError(t, err)
+	return response
+}
+
+// Get answers navigator.credentials.get, counting the signature
+func (a *Authenticator) Get(t *testing.T, rpID, challenge string) []byte {
+	a.SignCount++
+	authData := a.authData(t, rpID, false)
+	clientData := a.clientData(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.Key, digest[:])
+	require.NoError(t, err)
+	response, err := json.Marshal(map[string]any{
+		"id":    B64(a.CredentialId),
+		"rawId": B64(a.CredentialId),
+		"type":  "public-key",
+		"response": map[string]any{
+			"clientDataJSON":    B64(clientData),
+			"authenticatorData": B64(authData),
+			"signature":         B64(signature),
+			"userHandle":        B64(a.UserHandle),
+		},
+	})
+	require.NoError(t, err)
+	return response
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/EricWvi/dashboard/log"
 	"github.com/EricWvi/dashboard/model"
 	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
 	"gorm.io/gorm"
 )
 
@@ -32,6 +33,54 @@ func (ps *PruneScheduler) Start() {
 		log.Errorf(log.WorkerCtx, "Failed to schedule tiptap history pruning job: %v", err)
 		return
 	}
+	// Schedule the sync revision pruning job to run every day at 2:45 AM
+	_, err = ps.cron.AddFunc("45 2 * * *", ps.PruneSyncRevisionTask)
+	if err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to schedule sync revision pruning job: %v", err)
+		return
+	}
+
+	// Schedule the tombstone compaction job to run every day at 3:00 AM
+	_, err = ps.cron.AddFunc("0 3 * * *", ps.CompactTombstonesTask)
+	if err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to schedule tombstone compaction job: %v", err)
+		return
+	}
+
+	// Schedule the idempotency key pruning job to run every hour
+	_, err = ps.cron.AddFunc("15 * * * *", ps.PruneIdempotencyKeysTask)
+	if err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to schedule idempotency key pruning job: %v", err)
+		return
+	}
+
+	// Schedule the refresh token pruning job to run every day at 3:15 AM
+	_, err = ps.cron.AddFunc("15 3 * * *", ps.PruneRefreshTokensTask)
+	if err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to schedule refresh token pruning job: %v", err)
+		return
+	}
+
+	// Schedule the oidc login pruning job to run every hour
+	_, err = ps.cron.AddFunc("30 * * * *", ps.PruneOIDCLoginsTask)
+	if err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to schedule oidc login pruning job: %v", err)
+		return
+	}
+
+	// Schedule the passkey ceremony pruning job to run every hour
+	_, err = ps.cron.AddFunc("35 * * * *", ps.PrunePasskeyCeremoniesTask)
+	if err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to schedule passkey ceremony pruning job: %v", err)
+		return
+	}
+
+	// Schedule the audit event pruning job to run every day at 3:45 AM
+	_, err = ps.cron.AddFunc("45 3 * * *", ps.PruneAuditEventsTask)
+	if err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to schedule audit event pruning job: %v", err)
+		return
+	}
 
 	log.Info(log.WorkerCtx, "Prune scheduler started successfully")
 	ps.cron.Start()
@@ -59,3 +108,113 @@ func (ps *PruneScheduler) PruneTiptapHistoryTask() {
 		log.Info(log.WorkerCtx, "Tiptap history pruning job completed successfully.")
 	}
 }
+
+// PruneSyncRevisionTask prunes sync revisions older than 30 days, and tiptap
+// revisions beyond the newest sync.tiptapRevisions of each document. Pushes
+// based on an older version fall back to last-writer-wins, and pulls from it
+// get whole documents instead of patches.
+func (ps *PruneScheduler) PruneSyncRevisionTask() {
+	log.Info(log.WorkerCtx, "Starting sync revision pruning job")
+
+	thirtyDaysAgo := time.Now().AddDate(0, 0, -30)
+
+	if rows, err := model.PruneSyncRevisions(ps.db, thirtyDaysAgo); err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to prune sync revisions: %v", err)
+	} else {
+		log.Infof(log.WorkerCtx, "Pruned %d sync revisions.", rows)
+	}
+
+	keep := viper.GetInt("sync.tiptapRevisions")
+	if keep <= 0 {
+		keep = 20
+	}
+	if rows, err := model.PruneTiptapRevisions(ps.db, keep); err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to prune tiptap revisions: %v", err)
+	} else {
+		log.Infof(log.WorkerCtx, "Pruned %d tiptap revisions.", rows)
+		log.Info(log.WorkerCtx, "Sync revision pruning job completed successfully.")
+	}
+}
+
+// CompactTombstonesTask purges soft-deleted sync rows that every device active
+// within sync.tombstoneRetention has pulled, 30 days by default.
+func (ps *PruneScheduler) CompactTombstonesTask() {
+	log.Info(log.WorkerCtx, "Starting tombstone compaction job")
+
+	retention := viper.GetDuration("sync.tombstoneRetention")
+	if retention <= 0 {
+		retention = 30 * 24 * time.Hour
+	}
+
+	if rows, err := model.CompactTombstones(ps.db, time.Now().Add(-retention)); err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to compact tombstones: %v", err)
+	} else {
+		log.Infof(log.WorkerCtx, "Purged %d tombstones.", rows)
+		log.Info(log.WorkerCtx, "Tombstone compaction job completed successfully.")
+	}
+}
+
+// PruneIdempotencyKeysTask deletes the idempotency keys past idempotency.ttl.
+func (ps *PruneScheduler) PruneIdempotencyKeysTask() {
+	log.Info(log.WorkerCtx, "Starting idempotency key pruning job")
+
+	if rows, err := model.PruneIdempotencyKeys(ps.db, time.Now()); err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to prune idempotency keys: %v", err)
+	} else {
+		log.Infof(log.WorkerCtx, "Pruned %d idempotency keys.", rows)
+		log.Info(log.WorkerCtx, "Idempotency key pruning job completed successfully.")
+	}
+}
+
+// PruneRefreshTokensTask deletes the expired refresh tokens.
+func (ps *PruneScheduler) PruneRefreshTokensTask() {
+	log.Info(log.WorkerCtx, "Starting refresh token pruning job")
+
+	if rows, err := model.PruneRefreshTokens(ps.db, time.Now()); err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to prune refresh tokens: %v", err)
+	} else {
+		log.Infof(log.WorkerCtx, "Pruned %d refresh tokens.", rows)
+		log.Info(log.WorkerCtx, "Refresh token pruning job completed successfully.")
+	}
+}
+
+// PruneOIDCLoginsTask deletes the logins that were never completed.
+func (ps *PruneScheduler) PruneOIDCLoginsTask() {
+	log.Info(log.WorkerCtx, "Starting oidc login pruning job")
+
+	if rows, err := model.PruneOIDCLogins(ps.db, time.Now()); err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to prune oidc logins: %v", err)
+	} else {
+		log.Infof(log.WorkerCtx, "Pruned %d oidc logins.", rows)
+		log.Info(log.WorkerCtx, "Oidc login pruning job completed successfully.")
+	}
+}
+
+// PrunePasskeyCeremoniesTask deletes the passkey ceremonies that were never completed.
+func (ps *PruneScheduler) PrunePasskeyCeremoniesTask() {
+	log.Info(log.WorkerCtx, "Starting passkey ceremony pruning job")
+
+	if rows, err := model.PrunePasskeyCeremonies(ps.db, time.Now()); err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to prune passkey ceremonies: %v", err)
+	} else {
+		log.Infof(log.WorkerCtx, "Pruned %d passkey ceremonies.", rows)
+		log.Info(log.WorkerCtx, "Passkey ceremony pruning job completed successfully.")
+	}
+}
+
+// PruneAuditEventsTask deletes the audit events older than audit.retention,
+// events are kept forever when it is not set.
+func (ps *PruneScheduler) PruneAuditEventsTask() {
+	retention := viper.GetDuration("audit.retention")
+	if retention <= 0 {
+		return
+	}
+	log.Info(log.WorkerCtx, "Starting audit event pruning job")
+
+	if rows, err := model.PruneAuditEvents(ps.db, time.Now().Add(-retention)); err != nil {
+		log.Errorf(log.WorkerCtx, "Failed to prune audit events: %v", err)
+	} else {
+		log.Infof(log.WorkerCtx, "Pruned %d audit events.", rows)
+		log.Info(log.WorkerCtx, "Audit event pruning job completed successfully.")
+	}
+}
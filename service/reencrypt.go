@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EricWvi/dashboard/log"
+	"github.com/EricWvi/dashboard/model"
+	"gorm.io/gorm"
+)
+
+// ReencryptSecrets encrypts the credentials stored for every user with the
+// current key of keys, so that the previous keys can be retired. Legacy login
+// tokens are held by the clients and still need the legacy key until they are
+// exchanged. It returns how many users were rewritten.
+func ReencryptSecrets(ctx context.Context, db *gorm.DB, keys *Keyring) (int, error) {
+	rewritten := 0
+	for _, table := range []string{model.User_Table, model.UserV2_Table} {
+		secrets, err := model.ListUserSecrets(db, table)
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to list secrets of %s: %w", table, err)
+		}
+		for _, prev := range secrets {
+			next := prev
+			rss, rssChanged, err := keys.Reencrypt(prev.RssToken)
+			if err != nil {
+				return rewritten, fmt.Errorf("failed to re-encrypt rss token of %s user %d: %w", table, prev.Id, err)
+			}
+			email, emailChanged, err := keys.Reencrypt(prev.EmailToken)
+			if err != nil {
+				return rewritten, fmt.Errorf("failed to re-encrypt email token of %s user %d: %w", table, prev.Id, err)
+			}
+			if !rssChanged && !emailChanged {
+				continue
+			}
+			next.RssToken, next.EmailToken = rss, email
+			ok, err := model.ReplaceUserSecrets(db, table, prev, next)
+			if err != nil {
+				return rewritten, fmt.Errorf("failed to write secrets of %s user %d: %w", table, prev.Id, err)
+			}
+			if !ok {
+				// updated meanwhile, with the current key
+				log.Warnf(ctx, "secrets of %s user %d changed during re-encryption, skipped", table, prev.Id)
+				continue
+			}
+			rewritten++
+		}
+	}
+	return rewritten, nil
+}
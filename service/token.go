@@ -0,0 +1,149 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const tokenIssuer = "dashboard"
+
+// TokenSecret signs the access tokens.
+func TokenSecret() string {
+	return os.Getenv("DASHBOARD_TOKEN_SECRET")
+}
+
+// AccessClaims are carried by the access tokens sent in Onlyquant-Token. The
+// subject is the user id.
+type AccessClaims struct {
+	DeviceId string `json:"did,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// UserId returns the user the token was issued to.
+func (c *AccessClaims) UserId() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return 0, errors.New("token has no user")
+	}
+	return uint(id), nil
+}
+
+// IssueAccessToken signs an access token of userId on deviceId valid for ttl.
+func IssueAccessToken(secret string, userId uint, deviceId string, ttl time.Duration) (string, time.Time, error) {
+	return issueToken(secret, userId, deviceId, ttl, nil)
+}
+
+// ParseAccessToken checks the signature and expiry of an access token. Event
+// tickets are refused, they only open the events stream.
+func ParseAccessToken(secret, token string) (*AccessClaims, error) {
+	claims, err := parseToken(secret, token)
+	if err != nil {
+		return nil, err
+	}
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("token is not an access token")
+	}
+	return claims, nil
+}
+
+// eventTicketAudience is the audience of event tickets, see IssueEventTicket
+const eventTicketAudience = "events"
+
+// IssueEventTicket signs a ticket opening the events stream of userId on
+// deviceId within ttl. EventSource cannot send Onlyquant-Token, so the ticket
+// is sent in the URL instead, which is why it is short lived and good for
+// nothing else.
+func IssueEventTicket(secret string, userId uint, deviceId string, ttl time.Duration) (string, time.Time, error) {
+	return issueToken(secret, userId, deviceId, ttl, jwt.ClaimStrings{eventTicketAudience})
+}
+
+// ParseEventTicket checks the signature, expiry and audience of an event
+// ticket.
+func ParseEventTicket(secret, ticket string) (*AccessClaims, error) {
+	return parseToken(secret, ticket, jwt.WithAudience(eventTicketAudience))
+}
+
+func issueToken(secret string, userId uint, deviceId string, ttl time.Duration, audience jwt.ClaimStrings) (string, time.Time, error) {
+	if secret == "" {
+		return "", time.Time{}, errors.New("token secret is not set")
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, AccessClaims{
+		DeviceId: deviceId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   strconv.FormatUint(uint64(userId), 10),
+			Audience:  audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	signed, err := token.SignedString([]byte(secret))
+	return signed, expiresAt, err
+}
+
+func parseToken(secret, token string, options ...jwt.ParserOption) (*AccessClaims, error) {
+	if secret == "" {
+		return nil, errors.New("token secret is not set")
+	}
+	claims := &AccessClaims{}
+	options = append(options, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired())
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return []byte(secret), nil
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// personalTokenPrefix starts every personal access token
+const personalTokenPrefix = "oqp_"
+
+// NewPersonalToken returns a random personal access token along with its hash,
+// the only form it is stored in.
+func NewPersonalToken() (string, string, error) {
+	token, err := RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	token = personalTokenPrefix + token
+	return token, HashToken(token), nil
+}
+
+// IsPersonalToken tells whether token is a personal access token.
+func IsPersonalToken(token string) bool {
+	return strings.HasPrefix(token, personalTokenPrefix)
+}
+
+// IsLegacyToken tells whether token is an encrypted email issued before access
+// tokens, which are JWTs.
+func IsLegacyToken(token string) bool {
+	return strings.Count(token, ".") != 2
+}
+
+// NewRefreshToken returns a random refresh token along with its hash, the
+// only form it is stored in.
+func NewRefreshToken() (string, string, error) {
+	token, err := RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex SHA-256 of token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}